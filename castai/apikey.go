@@ -0,0 +1,123 @@
+package castai
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/go-resty/resty/v2"
+	"github.com/sirupsen/logrus"
+)
+
+// APIKeyFile reads the API key from a file, e.g. mounted from a Secret, and keeps it up to date when the key is
+// rotated.
+type APIKeyFile struct {
+	log  logrus.FieldLogger
+	path string
+
+	mu  sync.RWMutex
+	key string
+}
+
+func NewAPIKeyFile(log logrus.FieldLogger, path string) (*APIKeyFile, error) {
+	f := &APIKeyFile{log: log, path: path}
+	if _, err := f.Reload(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *APIKeyFile) Key() string {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.key
+}
+
+// Reload reads the key from the file again and reports whether it has changed. Previous key is kept on failure.
+func (f *APIKeyFile) Reload() (bool, error) {
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return false, fmt.Errorf("reading API key file: %w", err)
+	}
+	key := string(bytes.TrimSpace(data))
+	if key == "" {
+		return false, fmt.Errorf("API key file %s is empty", f.path)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	changed := key != f.key
+	f.key = key
+	return changed, nil
+}
+
+// Use sets the key on every request of the client. The key is reloaded when a request is rejected as unauthorized and
+// the request is sent once more if the key was rotated, even if the file change wasn't noticed. Other failures are
+// not retried by the client.
+func (f *APIKeyFile) Use(client *resty.Client) {
+	client.OnBeforeRequest(func(_ *resty.Client, req *resty.Request) error {
+		req.SetHeader(headerAPIKey, f.Key())
+		return nil
+	})
+	client.OnAfterResponse(func(_ *resty.Client, resp *resty.Response) error {
+		if resp.StatusCode() == http.StatusUnauthorized {
+			f.reload("request unauthorized")
+		}
+		return nil
+	})
+	client.SetRetryCount(max(client.RetryCount, 1))
+	client.SetRetryWaitTime(0)
+	client.AddRetryCondition(func(resp *resty.Response, _ error) bool {
+		return resp != nil && resp.StatusCode() == http.StatusUnauthorized &&
+			resp.Request.Header.Get(headerAPIKey) != f.Key()
+	})
+}
+
+// Watch reloads the key on changes of the file until stop is closed. Directory of the file is watched, as Secret
+// volumes replace files by swapping a symlink.
+func (f *APIKeyFile) Watch(stop <-chan struct{}) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("creating API key file watcher: %w", err)
+	}
+	if err := watcher.Add(filepath.Dir(f.path)); err != nil {
+		_ = watcher.Close()
+		return fmt.Errorf("watching API key file: %w", err)
+	}
+
+	go func() {
+		defer watcher.Close()
+		for {
+			select {
+			case <-stop:
+				return
+			case _, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				f.reload("file changed")
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				f.log.Errorf("watching API key file: %v", err)
+			}
+		}
+	}()
+	return nil
+}
+
+func (f *APIKeyFile) reload(reason string) {
+	changed, err := f.Reload()
+	if err != nil {
+		f.log.Errorf("reloading API key, %s: %v", reason, err)
+		return
+	}
+	if changed {
+		f.log.Infof("API key reloaded, %s", reason)
+	}
+}
@@ -0,0 +1,112 @@
+package castai
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIKeyFile(t *testing.T) {
+	log := logrus.New()
+
+	writeKey := func(t *testing.T, path, key string) {
+		require.NoError(t, os.WriteFile(path, []byte(key+"\n"), 0o600))
+	}
+
+	t.Run("reload key when file changes", func(t *testing.T) {
+		r := require.New(t)
+		path := filepath.Join(t.TempDir(), "api-key")
+		writeKey(t, path, "key1")
+
+		keyFile, err := NewAPIKeyFile(log, path)
+		r.NoError(err)
+		r.Equal("key1", keyFile.Key())
+
+		stop := make(chan struct{})
+		defer close(stop)
+		r.NoError(keyFile.Watch(stop))
+
+		writeKey(t, path, "key2")
+		r.Eventually(func() bool { return keyFile.Key() == "key2" }, 5*time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("send current key and reload it on unauthorized response", func(t *testing.T) {
+		r := require.New(t)
+		path := filepath.Join(t.TempDir(), "api-key")
+		writeKey(t, path, "old")
+
+		var mu sync.Mutex
+		var keys, eventTypes []string
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			key := req.Header.Get(headerAPIKey)
+			var event CloudEventRequest
+			_ = json.NewDecoder(req.Body).Decode(&event)
+			mu.Lock()
+			keys = append(keys, key)
+			eventTypes = append(eventTypes, event.EventType)
+			mu.Unlock()
+			if key != "new" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer s.Close()
+
+		rest, err := NewRestyClient(s.URL, "", TLSConfig{}, log.Level, time.Second, "0.0.0")
+		r.NoError(err)
+		keyFile, err := NewAPIKeyFile(log, path)
+		r.NoError(err)
+		keyFile.Use(rest)
+		client := NewClient(log, rest, "cluster", BatchConfig{})
+
+		// Key is rotated without the file watcher noticing it, the rejected request is sent again with the new key.
+		writeKey(t, path, "new")
+		r.NoError(client.SendCloudEvent(context.Background(), &CloudEventRequest{EventType: EventTypeInterrupted}))
+		r.NoError(client.SendCloudEvent(context.Background(), &CloudEventRequest{}))
+		r.Equal([]string{"old", "new", "new"}, keys)
+		r.Equal([]string{EventTypeInterrupted, EventTypeInterrupted, ""}, eventTypes)
+	})
+
+	t.Run("do not retry unauthorized request when key is unchanged", func(t *testing.T) {
+		r := require.New(t)
+		path := filepath.Join(t.TempDir(), "api-key")
+		writeKey(t, path, "revoked")
+
+		var calls atomic.Int32
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			calls.Add(1)
+			w.WriteHeader(http.StatusUnauthorized)
+		}))
+		defer s.Close()
+
+		rest, err := NewRestyClient(s.URL, "", TLSConfig{}, log.Level, time.Second, "0.0.0")
+		r.NoError(err)
+		keyFile, err := NewAPIKeyFile(log, path)
+		r.NoError(err)
+		keyFile.Use(rest)
+		client := NewClient(log, rest, "cluster", BatchConfig{})
+
+		var reqErr *RequestError
+		r.ErrorAs(client.SendCloudEvent(context.Background(), &CloudEventRequest{}), &reqErr)
+		r.Equal(http.StatusUnauthorized, reqErr.StatusCode)
+		r.Equal(int32(1), calls.Load())
+	})
+
+	t.Run("reject empty key file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "api-key")
+		writeKey(t, path, "")
+		_, err := NewAPIKeyFile(log, path)
+		require.Error(t, err)
+	})
+}
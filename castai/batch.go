@@ -0,0 +1,190 @@
+package castai
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// EventTypeInterrupted is the first event of an interruption. It's never delayed by the batch window, follow-up events
+// of the interruption and rebalance recommendations are.
+const EventTypeInterrupted = "interrupted"
+
+// BatchConfig configures sending cloud events queued within a short window in a single request.
+type BatchConfig struct {
+	// Window is how long the first queued event waits for others, zero disables batching.
+	Window time.Duration
+	// MaxEvents sends the batch right away once it's full.
+	MaxEvents int
+	// Gzip enables compressing request bodies. It's off by default, as backends ignoring Content-Encoding can't read
+	// compressed bodies.
+	Gzip bool
+}
+
+func DefaultBatchConfig() BatchConfig {
+	return BatchConfig{
+		Window:    100 * time.Millisecond,
+		MaxEvents: 20,
+	}
+}
+
+// CloudEventBatchRequest is sent to the batch endpoint, the mothership handles all events or none.
+type CloudEventBatchRequest struct {
+	Events []*CloudEventRequest `json:"events"`
+}
+
+type pendingEvent struct {
+	ctx    context.Context
+	req    *CloudEventRequest
+	result chan error
+}
+
+type batcher struct {
+	c   *client
+	cfg BatchConfig
+
+	mu      sync.Mutex
+	pending []*pendingEvent
+	timer   *time.Timer
+	// unsupported is set when the mothership rejects batches, events are sent one by one from then on.
+	unsupported bool
+}
+
+func newBatcher(c *client, cfg BatchConfig) *batcher {
+	return &batcher{c: c, cfg: cfg}
+}
+
+// send queues the event and waits until its batch is sent. Interruption events aren't delayed by the window, they're
+// sent right away together with the events queued so far.
+func (b *batcher) send(ctx context.Context, req *CloudEventRequest) error {
+	b.mu.Lock()
+	if b.unsupported {
+		b.mu.Unlock()
+		return b.c.sendCloudEvent(ctx, req)
+	}
+
+	ev := &pendingEvent{ctx: ctx, req: req, result: make(chan error, 1)}
+	b.pending = append(b.pending, ev)
+	switch {
+	case req.EventType == EventTypeInterrupted, b.cfg.MaxEvents > 0 && len(b.pending) >= b.cfg.MaxEvents:
+		if b.timer != nil {
+			b.timer.Stop()
+		}
+		go b.sendBatch(b.take())
+	case len(b.pending) == 1:
+		b.timer = time.AfterFunc(b.cfg.Window, b.flush)
+	}
+	b.mu.Unlock()
+
+	select {
+	case err := <-ev.result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (b *batcher) flush() {
+	b.mu.Lock()
+	events := b.take()
+	b.mu.Unlock()
+	b.sendBatch(events)
+}
+
+// take returns the pending events and starts a new batch, b.mu must be held.
+func (b *batcher) take() []*pendingEvent {
+	events := b.pending
+	b.pending = nil
+	b.timer = nil
+	return events
+}
+
+func (b *batcher) sendBatch(events []*pendingEvent) {
+	// Callers which stopped waiting retry on their own.
+	events = slices.DeleteFunc(events, func(ev *pendingEvent) bool { return ev.ctx.Err() != nil })
+	if len(events) == 0 {
+		return
+	}
+	ctx, cancel := batchContext(events)
+	defer cancel()
+
+	if len(events) == 1 {
+		events[0].result <- b.c.sendCloudEvent(ctx, events[0].req)
+		return
+	}
+
+	batch := &CloudEventBatchRequest{}
+	highPriority := false
+	for _, ev := range events {
+		batch.Events = append(batch.Events, ev.req)
+		highPriority = highPriority || isHighPriority(ev.req)
+	}
+
+	resp, err := b.c.post(ctx, b.c.eventsPath()+":batch", batch, highPriority)
+	switch {
+	case err != nil:
+		err = fmt.Errorf("sending %d cloud events: %w", len(events), err)
+	case batchRejected(resp.StatusCode()):
+		b.c.log.Warnf("mothership rejected batch with status %d, sending cloud events one by one from now on", resp.StatusCode())
+		b.mu.Lock()
+		b.unsupported = true
+		b.mu.Unlock()
+		for _, ev := range events {
+			ev.result <- b.c.sendCloudEvent(ctx, ev.req)
+		}
+		return
+	case resp.IsError():
+		err = newRequestError(fmt.Sprintf("sending %d cloud events", len(events)), resp)
+	}
+	for _, ev := range events {
+		ev.result <- err
+	}
+}
+
+// batchContext keeps values of the first caller's context and is bounded by the earliest deadline of the batched
+// events. Callers cancelling their context stop waiting for the batch, it's cancelled once all of them stopped.
+func batchContext(events []*pendingEvent) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.WithoutCancel(events[0].ctx))
+	var deadlines []time.Time
+	var waiting atomic.Int32
+	waiting.Store(int32(len(events)))
+	stops := make([]func() bool, 0, len(events))
+	for _, ev := range events {
+		if deadline, ok := ev.ctx.Deadline(); ok {
+			deadlines = append(deadlines, deadline)
+		}
+		stops = append(stops, context.AfterFunc(ev.ctx, func() {
+			if waiting.Add(-1) == 0 {
+				cancel()
+			}
+		}))
+	}
+	stop := func() {
+		for _, stop := range stops {
+			stop()
+		}
+		cancel()
+	}
+	if len(deadlines) == 0 {
+		return ctx, stop
+	}
+	ctx, cancelDeadline := context.WithDeadline(ctx, slices.MinFunc(deadlines, time.Time.Compare))
+	return ctx, func() {
+		cancelDeadline()
+		stop()
+	}
+}
+
+// batchRejected reports whether the status means the mothership doesn't support the batch endpoint.
+func batchRejected(status int) bool {
+	switch status {
+	case http.StatusNotFound, http.StatusMethodNotAllowed, http.StatusNotImplemented:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,288 @@
+package castai
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBatch(t *testing.T) {
+	log := logrus.New()
+
+	type request struct {
+		path       string
+		compressed bool
+		body       []byte
+	}
+
+	newClient := func(t *testing.T, cfg BatchConfig, status func(request) int) (Client, func() []request) {
+		var mu sync.Mutex
+		var requests []request
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, re *http.Request) {
+			req := request{path: re.URL.Path, compressed: re.Header.Get("Content-Encoding") == "gzip"}
+			body := re.Body
+			if req.compressed {
+				gz, err := gzip.NewReader(re.Body)
+				require.NoError(t, err)
+				body = gz
+			}
+			var err error
+			req.body, err = io.ReadAll(body)
+			require.NoError(t, err)
+
+			mu.Lock()
+			requests = append(requests, req)
+			mu.Unlock()
+			w.WriteHeader(status(req))
+		}))
+		t.Cleanup(s.Close)
+
+		rest, err := NewRestyClient(s.URL, "key", TLSConfig{}, log.Level, time.Second, "0.0.0")
+		require.NoError(t, err)
+		return NewClient(log, rest, "cluster", cfg), func() []request {
+			mu.Lock()
+			defer mu.Unlock()
+			return requests
+		}
+	}
+
+	sendAll := func(c Client, nodeIDs ...string) []error {
+		errs := make([]error, len(nodeIDs))
+		var wg sync.WaitGroup
+		for i, id := range nodeIDs {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs[i] = c.SendCloudEvent(context.Background(), &CloudEventRequest{EventType: EventTypeRebalanceRecommendation, NodeID: id})
+			}()
+		}
+		wg.Wait()
+		return errs
+	}
+
+	ok := func(request) int { return http.StatusOK }
+	gzipped := DefaultBatchConfig()
+	gzipped.Gzip = true
+
+	t.Run("send events queued within window in one compressed request", func(t *testing.T) {
+		r := require.New(t)
+		c, requests := newClient(t, gzipped, ok)
+
+		r.Equal([]error{nil, nil, nil}, sendAll(c, "a", "b", "c"))
+
+		got := requests()
+		r.Len(got, 1)
+		r.True(got[0].compressed)
+		r.Equal("/v1/kubernetes/external-clusters/cluster/events:batch", got[0].path)
+		var batch CloudEventBatchRequest
+		r.NoError(json.Unmarshal(got[0].body, &batch))
+		var ids []string
+		for _, ev := range batch.Events {
+			ids = append(ids, ev.NodeID)
+		}
+		r.ElementsMatch([]string{"a", "b", "c"}, ids)
+	})
+
+	t.Run("send single event to events endpoint", func(t *testing.T) {
+		r := require.New(t)
+		c, requests := newClient(t, DefaultBatchConfig(), ok)
+
+		r.NoError(c.SendCloudEvent(context.Background(), &CloudEventRequest{EventType: "interrupted", NodeID: "a"}))
+
+		got := requests()
+		r.Len(got, 1)
+		r.False(got[0].compressed)
+		r.Equal("/v1/kubernetes/external-clusters/cluster/events", got[0].path)
+		r.JSONEq(`{"event_type":"interrupted","node_id":"a","provider_id":null}`, string(got[0].body))
+	})
+
+	t.Run("batch follow-up interruption events", func(t *testing.T) {
+		r := require.New(t)
+		c, requests := newClient(t, DefaultBatchConfig(), ok)
+
+		errs := make([]error, 2)
+		var wg sync.WaitGroup
+		for i, eventType := range []string{"interruptionStarted", "interruptionTimeChanged"} {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs[i] = c.SendCloudEvent(context.Background(), &CloudEventRequest{EventType: eventType, NodeID: "a"})
+			}()
+		}
+		wg.Wait()
+
+		r.Equal([]error{nil, nil}, errs)
+		got := requests()
+		r.Len(got, 1)
+		r.Equal("/v1/kubernetes/external-clusters/cluster/events:batch", got[0].path)
+	})
+
+	t.Run("send full batch without waiting for window", func(t *testing.T) {
+		r := require.New(t)
+		cfg := DefaultBatchConfig()
+		cfg.Window = time.Minute
+		cfg.MaxEvents = 2
+		c, requests := newClient(t, cfg, ok)
+
+		r.Equal([]error{nil, nil}, sendAll(c, "a", "b"))
+		r.Len(requests(), 1)
+	})
+
+	t.Run("send high priority event right away with queued events", func(t *testing.T) {
+		r := require.New(t)
+		cfg := DefaultBatchConfig()
+		cfg.Window = time.Minute
+		c, requests := newClient(t, cfg, ok)
+
+		queued := make(chan error, 1)
+		go func() {
+			queued <- c.SendCloudEvent(context.Background(), &CloudEventRequest{EventType: EventTypeRebalanceRecommendation, NodeID: "a"})
+		}()
+		r.Eventually(func() bool {
+			b := c.(*client).batch
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			return len(b.pending) == 1
+		}, time.Second, time.Millisecond)
+
+		r.NoError(c.SendCloudEvent(context.Background(), &CloudEventRequest{EventType: "interrupted", NodeID: "b"}))
+		r.NoError(<-queued)
+		got := requests()
+		r.Len(got, 1)
+		r.Equal("/v1/kubernetes/external-clusters/cluster/events:batch", got[0].path)
+	})
+
+	t.Run("fall back to single sends when batches are rejected", func(t *testing.T) {
+		r := require.New(t)
+		c, requests := newClient(t, DefaultBatchConfig(), func(req request) int {
+			if strings.HasSuffix(req.path, ":batch") {
+				return http.StatusNotFound
+			}
+			return http.StatusOK
+		})
+
+		r.Equal([]error{nil, nil}, sendAll(c, "a", "b"))
+		r.Equal([]error{nil, nil}, sendAll(c, "c", "d"))
+
+		var paths []string
+		for _, req := range requests() {
+			paths = append(paths, req.path)
+		}
+		single := "/v1/kubernetes/external-clusters/cluster/events"
+		r.Equal([]string{single + ":batch", single, single, single, single}, paths)
+	})
+
+	t.Run("send uncompressed requests when compression is rejected", func(t *testing.T) {
+		r := require.New(t)
+		c, requests := newClient(t, gzipped, func(req request) int {
+			if req.compressed {
+				return http.StatusUnsupportedMediaType
+			}
+			return http.StatusOK
+		})
+
+		r.NoError(c.SendCloudEvent(context.Background(), &CloudEventRequest{EventType: "interrupted", NodeID: "a"}))
+		r.NoError(c.SendHeartbeat(context.Background(), &HeartbeatRequest{NodeName: "node"}))
+
+		got := requests()
+		r.Len(got, 3)
+		r.True(got[0].compressed)
+		r.False(got[1].compressed)
+		r.False(got[2].compressed)
+	})
+
+	t.Run("send uncompressed requests when compressed body can't be read", func(t *testing.T) {
+		r := require.New(t)
+		c, requests := newClient(t, gzipped, func(req request) int {
+			if req.compressed {
+				return http.StatusBadRequest
+			}
+			return http.StatusOK
+		})
+
+		r.NoError(c.SendCloudEvent(context.Background(), &CloudEventRequest{EventType: "interrupted", NodeID: "a"}))
+		r.NoError(c.SendHeartbeat(context.Background(), &HeartbeatRequest{NodeName: "node"}))
+
+		got := requests()
+		r.Len(got, 3)
+		r.True(got[0].compressed)
+		r.False(got[1].compressed)
+		r.False(got[2].compressed)
+	})
+
+	t.Run("keep compression when uncompressed request is rejected too", func(t *testing.T) {
+		r := require.New(t)
+		c, requests := newClient(t, gzipped, func(request) int { return http.StatusBadRequest })
+
+		r.Error(c.SendHeartbeat(context.Background(), &HeartbeatRequest{NodeName: "node"}))
+		r.Error(c.SendHeartbeat(context.Background(), &HeartbeatRequest{NodeName: "node"}))
+
+		var compressed []bool
+		for _, req := range requests() {
+			compressed = append(compressed, req.compressed)
+		}
+		r.Equal([]bool{true, false, true}, compressed)
+	})
+
+	t.Run("keep compression once compressed requests were read", func(t *testing.T) {
+		r := require.New(t)
+		var rejected atomic.Bool
+		c, requests := newClient(t, gzipped, func(request) int {
+			if rejected.Load() {
+				return http.StatusBadRequest
+			}
+			return http.StatusOK
+		})
+
+		r.NoError(c.SendHeartbeat(context.Background(), &HeartbeatRequest{NodeName: "node"}))
+		rejected.Store(true)
+		r.Error(c.SendHeartbeat(context.Background(), &HeartbeatRequest{NodeName: "node"}))
+
+		var compressed []bool
+		for _, req := range requests() {
+			compressed = append(compressed, req.compressed)
+		}
+		r.Equal([]bool{true, true}, compressed)
+	})
+
+	t.Run("report batch failure to all callers", func(t *testing.T) {
+		r := require.New(t)
+		c, _ := newClient(t, DefaultBatchConfig(), func(request) int { return http.StatusBadRequest })
+
+		for _, err := range sendAll(c, "a", "b") {
+			r.ErrorContains(err, "status_code=400")
+		}
+	})
+}
+
+func TestBatchContext(t *testing.T) {
+	r := require.New(t)
+	type key struct{}
+
+	first, cancelFirst := context.WithCancel(context.WithValue(context.Background(), key{}, "first"))
+	second, cancelSecond := context.WithTimeout(context.Background(), time.Minute)
+	defer cancelSecond()
+	ctx, cancel := batchContext([]*pendingEvent{{ctx: first}, {ctx: second}})
+	defer cancel()
+
+	r.Equal("first", ctx.Value(key{}))
+	deadline, ok := ctx.Deadline()
+	r.True(ok)
+	r.WithinDuration(time.Now().Add(time.Minute), deadline, time.Second)
+
+	cancelFirst()
+	r.Never(func() bool { return ctx.Err() != nil }, 50*time.Millisecond, 10*time.Millisecond)
+	cancelSecond()
+	r.Eventually(func() bool { return ctx.Err() != nil }, time.Second, 10*time.Millisecond)
+}
@@ -1,12 +1,17 @@
 package castai
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
 	"net/http"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-resty/resty/v2"
@@ -20,19 +25,29 @@ const (
 
 type Client interface {
 	SendCloudEvent(ctx context.Context, req *CloudEventRequest) error
+	// SendHeartbeat reports that the handler is running, so that nodes with broken handlers can be told apart from
+	// nodes without interruptions.
+	SendHeartbeat(ctx context.Context, req *HeartbeatRequest) error
 }
 
-func NewClient(log *logrus.Logger, rest *resty.Client, clusterID string) Client {
-	return &client{
+// NewClient creates the mothership client. Zero BatchConfig sends every event in a separate uncompressed request.
+func NewClient(log *logrus.Logger, rest *resty.Client, clusterID string, batch BatchConfig) Client {
+	c := &client{
 		log:       log,
 		rest:      rest,
 		clusterID: clusterID,
+		throttle:  newThrottler(log, DefaultThrottleConfig()),
 	}
+	c.gzip.Store(batch.Gzip)
+	if batch.Window > 0 {
+		c.batch = newBatcher(c, batch)
+	}
+	return c
 }
 
 // NewRestyClient configures a default instance of the resty.Client used to do HTTP requests.
-func NewRestyClient(url, key, ca string, level logrus.Level, timeout time.Duration, version string) (*resty.Client, error) {
-	clientTransport, err := createHTTPTransport(ca)
+func NewRestyClient(url, key string, tlsCfg TLSConfig, level logrus.Level, timeout time.Duration, version string) (*resty.Client, error) {
+	clientTransport, err := newReloadingTransport(tlsCfg)
 	if err != nil {
 		return nil, err
 	}
@@ -50,11 +65,7 @@ func NewRestyClient(url, key, ca string, level logrus.Level, timeout time.Durati
 	return client, nil
 }
 
-func createHTTPTransport(ca string) (*http.Transport, error) {
-	tlsConfig, err := createTLSConfig(ca)
-	if err != nil {
-		return nil, fmt.Errorf("creating TLS config: %v", err)
-	}
+func createHTTPTransport(tlsConfig *tls.Config) *http.Transport {
 	// Mostly copied from http.DefaultTransport.
 	return &http.Transport{
 		Proxy: http.ProxyFromEnvironment,
@@ -68,7 +79,7 @@ func createHTTPTransport(ca string) (*http.Transport, error) {
 		TLSHandshakeTimeout:   10 * time.Second,
 		ExpectContinueTimeout: 1 * time.Second,
 		TLSClientConfig:       tlsConfig,
-	}, nil
+	}
 }
 
 func createTLSConfig(ca string) (*tls.Config, error) {
@@ -90,26 +101,206 @@ type client struct {
 	log       *logrus.Logger
 	rest      *resty.Client
 	clusterID string
+	throttle  *throttler
+	// gzip is cleared when the mothership rejects compressed requests.
+	gzip atomic.Bool
+	// gzipChecked is set once the mothership responded to a compressed request.
+	gzipChecked atomic.Bool
+	// batch is nil when batching is disabled.
+	batch *batcher
 }
 
+// CloudEventSchemaVersion is the version of the CloudEventRequest payload. Version 1 carried only event type, node
+// ID and provider ID. Fields added later are optional and omitted when not set, so backends reading version 1 payloads
+// keep working.
+const CloudEventSchemaVersion = 2
+
 type CloudEventRequest struct {
 	EventType  string  `json:"event_type"`
 	NodeID     string  `json:"node_id"`
 	ProviderID *string `json:"provider_id"`
+
+	SchemaVersion int                `json:"schema_version,omitempty"`
+	Node          *CloudEventNode    `json:"node,omitempty"`
+	Handler       *CloudEventHandler `json:"handler,omitempty"`
+	Notice        *CloudEventNotice  `json:"notice,omitempty"`
+}
+
+// CloudEventNode describes the interrupted node.
+type CloudEventNode struct {
+	Name         string `json:"name"`
+	InstanceType string `json:"instance_type,omitempty"`
+	Zone         string `json:"zone,omitempty"`
+	Region       string `json:"region,omitempty"`
+	NodePool     string `json:"node_pool,omitempty"`
+	// Labels is a subset of node labels useful for analytics, not all labels of the node.
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// CloudEventHandler describes the handler which sent the event.
+type CloudEventHandler struct {
+	Version           string `json:"version,omitempty"`
+	Provider          string `json:"provider,omitempty"`
+	KubernetesVersion string `json:"kubernetes_version,omitempty"`
+}
+
+// CloudEventNotice describes the interruption notice as reported by the provider.
+type CloudEventNotice struct {
+	Action string     `json:"action,omitempty"`
+	Status string     `json:"status,omitempty"`
+	Time   *time.Time `json:"time,omitempty"`
+	// DetectedAt is when the handler first saw the notice.
+	DetectedAt *time.Time `json:"detected_at,omitempty"`
+	// DetectionLatencyMillis is the upper bound of the time the notice was present before it was detected, measured
+	// from the last poll which didn't see it.
+	DetectionLatencyMillis int64 `json:"detection_latency_ms,omitempty"`
+	// Raw is the notice as returned by the provider metadata service.
+	Raw json.RawMessage `json:"raw,omitempty"`
+}
+
+// HeartbeatRequest reports health of the handler.
+type HeartbeatRequest struct {
+	NodeID   string             `json:"node_id,omitempty"`
+	NodeName string             `json:"node_name"`
+	Handler  *CloudEventHandler `json:"handler"`
+	// LastSuccessfulPollAt is when the metadata service was last checked without error, nil if it never was.
+	LastSuccessfulPollAt *time.Time `json:"last_successful_poll_at,omitempty"`
+	// MetadataErrors and MothershipErrors count failures since the handler started.
+	MetadataErrors   int64 `json:"metadata_errors"`
+	MothershipErrors int64 `json:"mothership_errors"`
+}
+
+// RequestError is returned when the mothership responds with an error status.
+type RequestError struct {
+	Op         string
+	StatusCode int
+	Body       []byte
+}
+
+func (e *RequestError) Error() string {
+	return fmt.Sprintf("%s: request error status_code=%d body=%s", e.Op, e.StatusCode, e.Body)
+}
+
+// Retryable reports whether the request may succeed when sent again. Client errors other than rate limiting won't.
+func (e *RequestError) Retryable() bool {
+	return e.StatusCode >= http.StatusInternalServerError || e.StatusCode == http.StatusTooManyRequests
+}
+
+func newRequestError(op string, resp *resty.Response) error {
+	return &RequestError{Op: op, StatusCode: resp.StatusCode(), Body: resp.Body()}
+}
+
+func (c *client) SendHeartbeat(ctx context.Context, req *HeartbeatRequest) error {
+	resp, err := c.post(ctx, fmt.Sprintf("/v1/kubernetes/external-clusters/%s/spot-handler/heartbeat", c.clusterID), req, false)
+	if err != nil {
+		return fmt.Errorf("sending heartbeat: %w", err)
+	}
+	if resp.IsError() {
+		return newRequestError("sending heartbeat", resp)
+	}
+
+	return nil
 }
 
 func (c *client) SendCloudEvent(ctx context.Context, req *CloudEventRequest) error {
-	resp, err := c.rest.R().
-		SetBody(req).
-		SetContext(ctx).
-		Post(fmt.Sprintf("/v1/kubernetes/external-clusters/%s/events", c.clusterID))
+	if c.batch != nil {
+		return c.batch.send(ctx, req)
+	}
+	return c.sendCloudEvent(ctx, req)
+}
 
+func (c *client) sendCloudEvent(ctx context.Context, req *CloudEventRequest) error {
+	resp, err := c.post(ctx, c.eventsPath(), req, isHighPriority(req))
 	if err != nil {
 		return fmt.Errorf("sending aks spot interrupt: %w", err)
 	}
 	if resp.IsError() {
-		return fmt.Errorf("sending aks spot interrupt: request error status_code=%d body=%s", resp.StatusCode(), resp.Body())
+		return newRequestError("sending aks spot interrupt", resp)
 	}
 
 	return nil
 }
+
+func (c *client) eventsPath() string {
+	return fmt.Sprintf("/v1/kubernetes/external-clusters/%s/events", c.clusterID)
+}
+
+// post sends body as JSON, compressed if enabled and the mothership didn't reject compressed bodies before. Requests
+// are throttled and their responses and failures observed by the throttler.
+func (c *client) post(ctx context.Context, path string, body any, highPriority bool) (*resty.Response, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("marshaling request: %w", err)
+	}
+
+	compressed := c.gzip.Load()
+	resp, err := c.send(ctx, path, data, highPriority, compressed)
+	if err != nil || !compressed {
+		return resp, err
+	}
+
+	first := !c.gzipChecked.Swap(true)
+	switch resp.StatusCode() {
+	case http.StatusUnsupportedMediaType:
+		c.log.Warn("mothership rejected compressed request, sending uncompressed requests from now on")
+		c.gzip.Store(false)
+		return c.send(ctx, path, data, highPriority, false)
+	case http.StatusBadRequest:
+		if !first {
+			// Compressed bodies were read before, the request itself is invalid.
+			return resp, nil
+		}
+		// Backends ignoring Content-Encoding reject compressed bodies as invalid JSON. Compression is kept if the
+		// uncompressed request is rejected too, as the request itself is invalid then.
+		plain, err := c.send(ctx, path, data, highPriority, false)
+		if err == nil && plain.StatusCode() != http.StatusBadRequest {
+			c.log.Warn("mothership failed to read compressed request, sending uncompressed requests from now on")
+			c.gzip.Store(false)
+		}
+		return plain, err
+	default:
+		return resp, nil
+	}
+}
+
+func (c *client) send(ctx context.Context, path string, data []byte, highPriority, compressed bool) (*resty.Response, error) {
+	if err := c.throttle.wait(ctx, highPriority); err != nil {
+		return nil, err
+	}
+
+	req := c.rest.R().
+		SetContext(ctx).
+		SetHeader("Content-Type", "application/json")
+	if compressed {
+		gz, err := gzipBody(data)
+		if err != nil {
+			return nil, err
+		}
+		req.SetHeader("Content-Encoding", "gzip").SetBody(gz)
+	} else {
+		req.SetBody(data)
+	}
+
+	resp, err := req.Post(path)
+	if err != nil {
+		// Requests cancelled by the caller say nothing about the mothership.
+		if !errors.Is(ctx.Err(), context.Canceled) {
+			c.throttle.observeError()
+		}
+		return nil, err
+	}
+	c.throttle.observe(resp)
+	return resp, nil
+}
+
+func gzipBody(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, fmt.Errorf("compressing request: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("compressing request: %w", err)
+	}
+	return buf.Bytes(), nil
+}
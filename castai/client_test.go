@@ -1,9 +1,12 @@
 package castai
 
 import (
+	"encoding/json"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
+	"k8s.io/utils/ptr"
 )
 
 func TestNewRestryClient_TLS(t *testing.T) {
@@ -55,3 +58,48 @@ q276VYI/vYmMLRI/iE7Qjn9uGEeR1LWpVngE9jSzSdzByvzw3DwO4sL5B+rv7O1T
 		r.Nil(got)
 	})
 }
+
+func TestCloudEventRequest(t *testing.T) {
+	t.Run("serialize version 1 fields as before", func(t *testing.T) {
+		r := require.New(t)
+
+		b, err := json.Marshal(&CloudEventRequest{EventType: "interrupted", NodeID: "node-id"})
+		r.NoError(err)
+		r.JSONEq(`{"event_type":"interrupted","node_id":"node-id","provider_id":null}`, string(b))
+	})
+
+	t.Run("serialize extended fields", func(t *testing.T) {
+		r := require.New(t)
+
+		at := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		b, err := json.Marshal(&CloudEventRequest{
+			EventType:     "interrupted",
+			NodeID:        "node-id",
+			ProviderID:    ptr.To("aws:///eu-central-1a/i-1"),
+			SchemaVersion: CloudEventSchemaVersion,
+			Node:          &CloudEventNode{Name: "node", InstanceType: "m5.large", Labels: map[string]string{"k": "v"}},
+			Handler:       &CloudEventHandler{Version: "v1", Provider: "aws", KubernetesVersion: "1.29"},
+			Notice: &CloudEventNotice{
+				Action:                 "terminate",
+				Time:                   &at,
+				DetectionLatencyMillis: 1500,
+				Raw:                    json.RawMessage(`{"action":"terminate"}`),
+			},
+		})
+		r.NoError(err)
+		r.JSONEq(`{
+			"event_type": "interrupted",
+			"node_id": "node-id",
+			"provider_id": "aws:///eu-central-1a/i-1",
+			"schema_version": 2,
+			"node": {"name": "node", "instance_type": "m5.large", "labels": {"k": "v"}},
+			"handler": {"version": "v1", "provider": "aws", "kubernetes_version": "1.29"},
+			"notice": {
+				"action": "terminate",
+				"time": "2024-01-01T00:00:00Z",
+				"detection_latency_ms": 1500,
+				"raw": {"action": "terminate"}
+			}
+		}`, string(b))
+	})
+}
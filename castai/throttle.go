@@ -0,0 +1,171 @@
+package castai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/time/rate"
+)
+
+// EventTypeRebalanceRecommendation is sent with lower priority than interruption events, it's delayed by the rate
+// limit and rejected while the circuit breaker is open. Heartbeats have the same low priority.
+const EventTypeRebalanceRecommendation = "rebalanceRecommendation"
+
+func isHighPriority(req *CloudEventRequest) bool {
+	return req.EventType != EventTypeRebalanceRecommendation
+}
+
+// maxRetryAfter caps the wait requested by the mothership.
+const maxRetryAfter = 5 * time.Minute
+
+// ErrCircuitOpen is returned for low priority events while the mothership keeps failing.
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+// ThrottleConfig protects the mothership from all handlers retrying at once during a mass spot reclaim.
+type ThrottleConfig struct {
+	// RequestsPerSecond and Burst limit requests of a single handler.
+	RequestsPerSecond float64
+	Burst             int
+	// MaxJitter is the maximum random delay added to waits, so that handlers don't retry in lockstep.
+	MaxJitter time.Duration
+	// DefaultRetryAfter is the wait after 429 responses without Retry-After header.
+	DefaultRetryAfter time.Duration
+	// FailureThreshold consecutive 5xx responses or failed requests open the circuit breaker for OpenDuration.
+	FailureThreshold int
+	OpenDuration     time.Duration
+}
+
+func DefaultThrottleConfig() ThrottleConfig {
+	return ThrottleConfig{
+		RequestsPerSecond: 1,
+		Burst:             3,
+		MaxJitter:         time.Second,
+		DefaultRetryAfter: 5 * time.Second,
+		FailureThreshold:  5,
+		OpenDuration:      30 * time.Second,
+	}
+}
+
+type throttler struct {
+	log     logrus.FieldLogger
+	cfg     ThrottleConfig
+	limiter *rate.Limiter
+
+	mu sync.Mutex
+	// notBefore is set from Retry-After of throttled responses.
+	notBefore time.Time
+	failures  int
+	openUntil time.Time
+}
+
+func newThrottler(log logrus.FieldLogger, cfg ThrottleConfig) *throttler {
+	return &throttler{
+		log:     log,
+		cfg:     cfg,
+		limiter: rate.NewLimiter(rate.Limit(cfg.RequestsPerSecond), cfg.Burst),
+	}
+}
+
+// wait blocks until the request can be sent. High priority requests are sent while the circuit is open and don't
+// wait for the rate limit, but still take its tokens so that low priority requests are sent after them.
+func (t *throttler) wait(ctx context.Context, highPriority bool) error {
+	now := time.Now()
+	t.mu.Lock()
+	notBefore, openUntil := t.notBefore, t.openUntil
+	t.mu.Unlock()
+
+	if !highPriority && now.Before(openUntil) {
+		return fmt.Errorf("%w until %s", ErrCircuitOpen, openUntil.Format(time.RFC3339))
+	}
+
+	delay := notBefore.Sub(now)
+	reservation := t.limiter.ReserveN(now, 1)
+	if !highPriority && reservation.OK() {
+		if d := reservation.DelayFrom(now); d > 0 {
+			delay = max(delay, d+t.jitter())
+		}
+	}
+	if delay <= 0 {
+		return nil
+	}
+
+	if deadline, ok := ctx.Deadline(); ok && now.Add(delay).After(deadline) {
+		reservation.CancelAt(now)
+		return fmt.Errorf("throttled for %s, longer than request deadline", delay)
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		reservation.Cancel()
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// observe updates throttling state from the response.
+func (t *throttler) observe(resp *resty.Response) {
+	status := resp.StatusCode()
+	now := time.Now()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if status == http.StatusTooManyRequests || (status == http.StatusServiceUnavailable && resp.Header().Get("Retry-After") != "") {
+		wait := retryAfter(resp.Header().Get("Retry-After"), now, t.cfg.DefaultRetryAfter) + t.jitter()
+		t.notBefore = now.Add(wait)
+		t.log.Warnf("mothership throttled request with status %d, waiting %s", status, wait)
+	}
+
+	switch {
+	case status >= http.StatusInternalServerError:
+		t.failed(now)
+	case status != http.StatusTooManyRequests:
+		t.failures = 0
+		t.openUntil = time.Time{}
+	}
+}
+
+// observeError counts requests which got no response, e.g. because of timeouts or refused connections, as failures.
+func (t *throttler) observeError() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.failed(time.Now())
+}
+
+// failed opens the circuit once the mothership failed too many times in a row, t.mu must be held.
+func (t *throttler) failed(now time.Time) {
+	t.failures++
+	// Circuit is reopened by the first failure after it closes, until a request succeeds.
+	if t.failures >= t.cfg.FailureThreshold {
+		t.openUntil = now.Add(t.cfg.OpenDuration + t.jitter())
+		t.log.Warnf("mothership failed %d times in a row, circuit breaker open until %s", t.failures, t.openUntil.Format(time.RFC3339))
+	}
+}
+
+func (t *throttler) jitter() time.Duration {
+	if t.cfg.MaxJitter <= 0 {
+		return 0
+	}
+	return rand.N(t.cfg.MaxJitter)
+}
+
+// retryAfter parses Retry-After header, which is either seconds or HTTP date.
+func retryAfter(header string, now time.Time, def time.Duration) time.Duration {
+	wait := def
+	if seconds, err := strconv.Atoi(header); err == nil {
+		wait = time.Duration(seconds) * time.Second
+	} else if at, err := http.ParseTime(header); err == nil {
+		wait = at.Sub(now)
+	}
+	return min(max(wait, 0), maxRetryAfter)
+}
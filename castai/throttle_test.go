@@ -0,0 +1,145 @@
+package castai
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestThrottle(t *testing.T) {
+	log := logrus.New()
+
+	newClient := func(t *testing.T, cfg ThrottleConfig, handler http.HandlerFunc) *client {
+		s := httptest.NewServer(handler)
+		t.Cleanup(s.Close)
+		rest, err := NewRestyClient(s.URL, "key", TLSConfig{}, log.Level, time.Second, "0.0.0")
+		require.NoError(t, err)
+		c := NewClient(log, rest, "cluster", BatchConfig{}).(*client)
+		c.throttle = newThrottler(log, cfg)
+		return c
+	}
+
+	cfg := ThrottleConfig{
+		RequestsPerSecond: 100,
+		Burst:             10,
+		DefaultRetryAfter: time.Second,
+		FailureThreshold:  2,
+		OpenDuration:      time.Minute,
+	}
+	interrupted := &CloudEventRequest{EventType: "interrupted"}
+	rebalance := &CloudEventRequest{EventType: EventTypeRebalanceRecommendation}
+
+	t.Run("wait for Retry-After of throttled response", func(t *testing.T) {
+		r := require.New(t)
+		var calls atomic.Int32
+		c := newClient(t, cfg, func(w http.ResponseWriter, _ *http.Request) {
+			if calls.Add(1) == 1 {
+				w.Header().Set("Retry-After", "1")
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		})
+
+		r.Error(c.SendCloudEvent(context.Background(), interrupted))
+		start := time.Now()
+		r.NoError(c.SendCloudEvent(context.Background(), interrupted))
+		r.GreaterOrEqual(time.Since(start), 900*time.Millisecond)
+
+		c.throttle.notBefore = time.Now().Add(time.Minute)
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		r.ErrorContains(c.SendCloudEvent(ctx, interrupted), "throttled")
+		r.Equal(int32(2), calls.Load())
+	})
+
+	t.Run("open circuit for rebalance recommendations on repeated server errors", func(t *testing.T) {
+		r := require.New(t)
+		var calls atomic.Int32
+		var healthy atomic.Bool
+		c := newClient(t, cfg, func(w http.ResponseWriter, _ *http.Request) {
+			calls.Add(1)
+			if !healthy.Load() {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		})
+
+		r.Error(c.SendCloudEvent(context.Background(), rebalance))
+		r.Error(c.SendCloudEvent(context.Background(), rebalance))
+		r.ErrorIs(c.SendCloudEvent(context.Background(), rebalance), ErrCircuitOpen)
+		r.Equal(int32(2), calls.Load())
+
+		// Interruption events are still sent and close the circuit once the mothership recovers.
+		healthy.Store(true)
+		r.NoError(c.SendCloudEvent(context.Background(), interrupted))
+		r.NoError(c.SendCloudEvent(context.Background(), rebalance))
+		r.Equal(int32(4), calls.Load())
+	})
+
+	t.Run("open circuit for rebalance recommendations on repeated timeouts", func(t *testing.T) {
+		r := require.New(t)
+		var calls atomic.Int32
+		c := newClient(t, cfg, func(w http.ResponseWriter, req *http.Request) {
+			calls.Add(1)
+			// Longer than the client timeout.
+			select {
+			case <-req.Context().Done():
+			case <-time.After(2 * time.Second):
+			}
+		})
+
+		r.Error(c.SendCloudEvent(context.Background(), rebalance))
+		r.Error(c.SendCloudEvent(context.Background(), rebalance))
+		r.ErrorIs(c.SendCloudEvent(context.Background(), rebalance), ErrCircuitOpen)
+		r.Equal(int32(2), calls.Load())
+	})
+
+	t.Run("ignore requests cancelled by the caller", func(t *testing.T) {
+		r := require.New(t)
+		c := newClient(t, cfg, func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		r.Error(c.SendCloudEvent(ctx, rebalance))
+		r.Error(c.SendCloudEvent(ctx, rebalance))
+		r.NoError(c.SendCloudEvent(context.Background(), rebalance))
+	})
+
+	t.Run("send interruption events ahead of rate limited rebalance recommendations", func(t *testing.T) {
+		r := require.New(t)
+		limited := cfg
+		limited.RequestsPerSecond = 1
+		limited.Burst = 1
+		c := newClient(t, limited, func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		})
+
+		r.NoError(c.SendCloudEvent(context.Background(), rebalance))
+		start := time.Now()
+		r.NoError(c.SendCloudEvent(context.Background(), interrupted))
+		r.Less(time.Since(start), 500*time.Millisecond)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+		defer cancel()
+		r.ErrorContains(c.SendCloudEvent(ctx, rebalance), "throttled")
+	})
+
+	t.Run("parse Retry-After", func(t *testing.T) {
+		r := require.New(t)
+		now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		r.Equal(3*time.Second, retryAfter("3", now, time.Second))
+		r.Equal(10*time.Second, retryAfter(now.Add(10*time.Second).Format(http.TimeFormat), now, time.Second))
+		r.Equal(time.Second, retryAfter("", now, time.Second))
+		r.Equal(maxRetryAfter, retryAfter("86400", now, time.Second))
+	})
+}
@@ -0,0 +1,172 @@
+package castai
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/sirupsen/logrus"
+
+	"github.com/castai/spot-handler/tlsutil"
+)
+
+// TLSConfig configures TLS of connections to CAST AI, e.g. an on-prem gateway with a private CA and mutual TLS.
+type TLSConfig struct {
+	// CACert is either a PEM encoded CA bundle or a path to a file with it. Files are reloaded by WatchTLS.
+	CACert string
+	// ClientCertFile and ClientKeyFile are paths to PEM encoded client certificate and key used for mutual TLS.
+	ClientCertFile string
+	ClientKeyFile  string
+	// MinVersion is the minimum TLS version, "1.2" or "1.3". Go default is used when empty.
+	MinVersion string
+}
+
+func parseTLSVersion(v string) (uint16, error) {
+	switch v {
+	case "":
+		return 0, nil
+	case "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	default:
+		return 0, fmt.Errorf("unsupported TLS version %q", v)
+	}
+}
+
+func (c TLSConfig) hasFiles() bool {
+	return (c.CACert != "" && !tlsutil.IsPEM(c.CACert)) || c.ClientCertFile != ""
+}
+
+// load builds the tls.Config and a fingerprint of the certificate material used to detect changes on reload.
+func (c TLSConfig) load() (*tls.Config, [sha256.Size]byte, error) {
+	var material bytes.Buffer
+
+	ca := c.CACert
+	if ca != "" && !tlsutil.IsPEM(ca) {
+		data, err := os.ReadFile(ca)
+		if err != nil {
+			return nil, [sha256.Size]byte{}, fmt.Errorf("reading CA certificate: %w", err)
+		}
+		ca = string(data)
+	}
+	material.WriteString(ca)
+
+	tlsConfig, err := createTLSConfig(ca)
+	if err != nil {
+		return nil, [sha256.Size]byte{}, err
+	}
+
+	minVersion, err := parseTLSVersion(c.MinVersion)
+	if err != nil {
+		return nil, [sha256.Size]byte{}, err
+	}
+	if tlsConfig == nil && c.ClientCertFile == "" && minVersion == 0 {
+		return nil, sha256.Sum256(material.Bytes()), nil
+	}
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{}
+	}
+	tlsConfig.MinVersion = minVersion
+
+	if c.ClientCertFile != "" {
+		certPEM, err := os.ReadFile(c.ClientCertFile)
+		if err != nil {
+			return nil, [sha256.Size]byte{}, fmt.Errorf("reading client certificate: %w", err)
+		}
+		keyPEM, err := os.ReadFile(c.ClientKeyFile)
+		if err != nil {
+			return nil, [sha256.Size]byte{}, fmt.Errorf("reading client key: %w", err)
+		}
+		cert, err := tls.X509KeyPair(certPEM, keyPEM)
+		if err != nil {
+			return nil, [sha256.Size]byte{}, fmt.Errorf("loading client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+		material.Write(certPEM)
+		material.Write(keyPEM)
+	}
+
+	return tlsConfig, sha256.Sum256(material.Bytes()), nil
+}
+
+// reloadingTransport swaps the underlying transport when certificates change, so that new connections use them
+// while requests in flight complete on the old ones.
+type reloadingTransport struct {
+	cfg TLSConfig
+
+	mu          sync.RWMutex
+	current     *http.Transport
+	fingerprint [sha256.Size]byte
+}
+
+func newReloadingTransport(cfg TLSConfig) (*reloadingTransport, error) {
+	t := &reloadingTransport{cfg: cfg}
+	if _, err := t.reload(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (t *reloadingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mu.RLock()
+	current := t.current
+	t.mu.RUnlock()
+	return current.RoundTrip(req)
+}
+
+// reload reads certificates again and reports whether they have changed. Previous transport is kept on failure.
+func (t *reloadingTransport) reload() (bool, error) {
+	tlsConfig, fingerprint, err := t.cfg.load()
+	if err != nil {
+		return false, fmt.Errorf("creating TLS config: %w", err)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.current != nil && fingerprint == t.fingerprint {
+		return false, nil
+	}
+	previous := t.current
+	t.current = createHTTPTransport(tlsConfig)
+	t.fingerprint = fingerprint
+	if previous != nil {
+		previous.CloseIdleConnections()
+	}
+	return true, nil
+}
+
+// WatchTLS reloads certificate files of the client every interval until stop is closed. Nothing is watched if
+// certificates are passed inline.
+func WatchTLS(log logrus.FieldLogger, client *resty.Client, interval time.Duration, stop <-chan struct{}) {
+	t, ok := client.GetClient().Transport.(*reloadingTransport)
+	if !ok || !t.cfg.hasFiles() || interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				changed, err := t.reload()
+				if err != nil {
+					log.Errorf("reloading TLS certificates: %v", err)
+					continue
+				}
+				if changed {
+					log.Info("TLS certificates reloaded")
+				}
+			}
+		}
+	}()
+}
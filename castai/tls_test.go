@@ -0,0 +1,157 @@
+package castai
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTLS(t *testing.T) {
+	log := logrus.New()
+
+	newServer := func(t *testing.T, cert tls.Certificate, clientCAs *x509.CertPool) *httptest.Server {
+		s := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}))
+		s.TLS = &tls.Config{Certificates: []tls.Certificate{cert}}
+		if clientCAs != nil {
+			s.TLS.ClientAuth = tls.RequireAndVerifyClientCert
+			s.TLS.ClientCAs = clientCAs
+		}
+		s.StartTLS()
+		t.Cleanup(s.Close)
+		return s
+	}
+
+	t.Run("load CA from file and reload it when changed", func(t *testing.T) {
+		r := require.New(t)
+		dir := t.TempDir()
+		oldCA := newTestCert(t, nil)
+		newCA := newTestCert(t, nil)
+		s := newServer(t, newTestCert(t, &newCA).tls, nil)
+
+		caFile := filepath.Join(dir, "ca.pem")
+		r.NoError(os.WriteFile(caFile, oldCA.certPEM, 0o600))
+
+		client, err := NewRestyClient(s.URL, "", TLSConfig{CACert: caFile}, log.Level, time.Second, "0.0.0")
+		r.NoError(err)
+		_, err = client.R().Get("/")
+		r.Error(err)
+
+		stop := make(chan struct{})
+		defer close(stop)
+		WatchTLS(log, client, 10*time.Millisecond, stop)
+		r.NoError(os.WriteFile(caFile, newCA.certPEM, 0o600))
+
+		r.Eventually(func() bool {
+			resp, err := client.R().Get("/")
+			return err == nil && resp.StatusCode() == http.StatusOK
+		}, 5*time.Second, 20*time.Millisecond)
+	})
+
+	t.Run("present client certificate", func(t *testing.T) {
+		r := require.New(t)
+		dir := t.TempDir()
+		ca := newTestCert(t, nil)
+		pool := x509.NewCertPool()
+		pool.AppendCertsFromPEM(ca.certPEM)
+		s := newServer(t, newTestCert(t, &ca).tls, pool)
+
+		clientCert := newTestCert(t, &ca)
+		certFile := filepath.Join(dir, "tls.crt")
+		keyFile := filepath.Join(dir, "tls.key")
+		r.NoError(os.WriteFile(certFile, clientCert.certPEM, 0o600))
+		r.NoError(os.WriteFile(keyFile, clientCert.keyPEM, 0o600))
+
+		client, err := NewRestyClient(s.URL, "", TLSConfig{CACert: string(ca.certPEM)}, log.Level, time.Second, "0.0.0")
+		r.NoError(err)
+		_, err = client.R().Get("/")
+		r.Error(err)
+
+		client, err = NewRestyClient(s.URL, "", TLSConfig{
+			CACert:         string(ca.certPEM),
+			ClientCertFile: certFile,
+			ClientKeyFile:  keyFile,
+			MinVersion:     "1.3",
+		}, log.Level, time.Second, "0.0.0")
+		r.NoError(err)
+		resp, err := client.R().Get("/")
+		r.NoError(err)
+		r.Equal(http.StatusOK, resp.StatusCode())
+		r.Equal(uint16(tls.VersionTLS13), resp.RawResponse.TLS.Version)
+	})
+
+	t.Run("reject invalid settings", func(t *testing.T) {
+		r := require.New(t)
+
+		_, err := NewRestyClient("https://localhost", "", TLSConfig{MinVersion: "1.0"}, log.Level, time.Second, "0.0.0")
+		r.Error(err)
+		_, err = NewRestyClient("https://localhost", "", TLSConfig{CACert: "/does/not/exist"}, log.Level, time.Second, "0.0.0")
+		r.Error(err)
+	})
+}
+
+type testCert struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM []byte
+	keyPEM  []byte
+	tls     tls.Certificate
+}
+
+// newTestCert creates a CA when parent is nil, otherwise a localhost certificate signed by parent.
+func newTestCert(t *testing.T, parent *testCert) testCert {
+	r := require.New(t)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	r.NoError(err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{Organization: []string{"Test"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	signer, signerKey := tmpl, key
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+		tmpl.KeyUsage = x509.KeyUsageCertSign
+	} else {
+		tmpl.DNSNames = []string{"localhost"}
+		tmpl.IPAddresses = []net.IP{net.ParseIP("127.0.0.1")}
+		tmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}
+		signer, signerKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	r.NoError(err)
+	cert, err := x509.ParseCertificate(der)
+	r.NoError(err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	r.NoError(err)
+
+	c := testCert{
+		cert:    cert,
+		key:     key,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPEM:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}
+	c.tls, err = tls.X509KeyPair(c.certPEM, c.keyPEM)
+	r.NoError(err)
+	return c
+}
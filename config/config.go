@@ -1,72 +1,266 @@
 package config
 
 import (
+	"encoding/json"
 	"fmt"
+	"os"
+	"reflect"
 
+	"github.com/fsnotify/fsnotify"
+	"github.com/go-viper/mapstructure/v2"
+	"github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 )
 
+// envConfigFile is the path of the optional YAML config file, e.g. mounted from a ConfigMap.
+const envConfigFile = "CONFIG_FILE"
+
 type Config struct {
 	NodeName            string
 	APIUrl              string
 	APIKey              string
+	APIKeyFile          string
 	TLSCACert           string
+	TLS                 TLSConfig
 	Kubeconfig          string
 	ClusterID           string
 	Provider            string
 	LogLevel            int
 	PprofPort           int
+	MetricsPort         int
+	SimulationPort      int
+	SimulationToken     string
 	PollIntervalSeconds int
 	Phase2Permissions   bool
-}
+	Webhook             WebhookConfig
+	Hooks               HooksConfig
+	Drain               DrainConfig
 
-var cfg *Config
+	// OutOfServiceTaint enables tainting the node out-of-service once it's shut down after the interruption, requires
+	// Phase2Permissions and Kubernetes 1.26 or newer.
+	OutOfServiceTaint bool
 
-// Get configuration bound to environment variables.
-func Get() Config {
-	if cfg != nil {
-		return *cfg
-	}
+	// AnnotatePods enables annotating pods on the node with interruption details for the Downward API.
+	AnnotatePods bool
+
+	// MetadataURL overrides the instance metadata service address, e.g. to use the fake-imds command.
+	MetadataURL string
+
+	// Standalone disables the mothership notifier, so that API_KEY, API_URL and CLUSTER_ID are not required and
+	// only local node actions and other notifiers are run.
+	Standalone bool
+
+	// DryRun disables mothership calls and node changes, the handler only logs what it would have done.
+	DryRun bool
+
+	// MothershipBatchWindowMillis is how long cloud events are queued to be sent in one request, 0 disables batching.
+	// The first event of an interruption is sent right away.
+	MothershipBatchWindowMillis int
+	// MothershipGzip enables compressing request bodies sent to the mothership.
+	MothershipGzip bool
+
+	// HeartbeatIntervalSeconds is how often the handler reports its health to the mothership, 0 disables heartbeats.
+	HeartbeatIntervalSeconds int
 
-	_ = viper.BindEnv("loglevel", "LOG_LEVEL")
+	// PollTimeoutSeconds bounds metadata checks of a single poll.
+	PollTimeoutSeconds int
+	// ShutdownGracePeriodSeconds is how long the handler keeps polling after termination signal.
+	ShutdownGracePeriodSeconds int
 
-	_ = viper.BindEnv("apikey", "API_KEY")
-	_ = viper.BindEnv("apiurl", "API_URL")
-	_ = viper.BindEnv("tlscacert", "TLS_CA_CERT_FILE")
-	_ = viper.BindEnv("kubeconfig", "KUBECONFIG")
-	_ = viper.BindEnv("nodename", "NODE_NAME")
-	_ = viper.BindEnv("clusterid", "CLUSTER_ID")
-	_ = viper.BindEnv("provider", "PROVIDER")
+	// Retry settings of node lookups, node updates and mothership calls. Zero values use handler defaults.
+	RetryInitialIntervalMillis int
+	RetryMaxIntervalSeconds    int
+	RetryMaxElapsedSeconds     int
+}
+
+type WebhookConfig struct {
+	URL            string
+	Secret         string
+	Template       string
+	TimeoutSeconds int
+	MaxRetries     int
+}
+
+// TLSConfig configures TLS of connections to CAST AI in addition to TLSCACert, which is either PEM content or a
+// path to a file with it.
+type TLSConfig struct {
+	ClientCertFile string
+	ClientKeyFile  string
+	// MinVersion is "1.2" or "1.3".
+	MinVersion string
+	// ReloadIntervalSeconds is how often certificate files are re-read, 0 disables reloading.
+	ReloadIntervalSeconds int
+}
 
-	_ = viper.BindEnv("pollintervalseconds", "POLL_INTERVAL_SECONDS")
-	_ = viper.BindEnv("pprofport", "PPROF_PORT")
+// HooksConfig configures pre-termination hooks run on interruption notice.
+type HooksConfig struct {
+	// Pods enables calling pods on the node annotated with spot-handler.cast.ai/preStop-url.
+	Pods bool
+	// Commands is a JSON list of commands, e.g. [{"name":"flush","command":["/bin/flush"],"timeoutSeconds":10}].
+	Commands       string
+	TimeoutSeconds int
+}
 
-	_ = viper.BindEnv("phase2permissions", "PHASE2_PERMISSIONS")
+// DrainConfig configures eviction of pods from the interrupted node.
+type DrainConfig struct {
+	Enabled bool
+	// Groups is a JSON list of drain groups in eviction order, e.g.
+	// [{"name":"batch","priorityClassNames":["batch"]},{"name":"rest","concurrency":2}].
+	Groups         string
+	Concurrency    int
+	TimeoutSeconds int
+	// Strategy is "evict" or "reschedule-aware", which waits for replacement pods on other nodes before eviction.
+	Strategy         string
+	MinReadyReplicas int
+	// VolumeDetach is "delete-attachments", run after the node is drained.
+	VolumeDetach string
+}
 
-	cfg = &Config{}
-	if err := viper.Unmarshal(&cfg); err != nil {
-		panic(fmt.Errorf("parsing configuration: %v", err))
+// Load reads configuration from the optional CONFIG_FILE and environment variables and validates it. Environment
+// variables take precedence over the file, overrides, e.g. of command line flags, take precedence over both. All
+// problems found are reported at once as *ValidationError.
+func Load(overrides ...func(*Config)) (Config, error) {
+	v := newViper()
+	if path := os.Getenv(envConfigFile); path != "" {
+		v.SetConfigFile(path)
+		if err := v.ReadInConfig(); err != nil {
+			return Config{}, fmt.Errorf("reading config file: %w", err)
+		}
 	}
+	return load(v, overrides...)
+}
 
-	if cfg.APIKey == "" {
-		required("API_KEY")
+// Watch reloads CONFIG_FILE on changes and calls onChange with the new configuration. Invalid configuration is
+// passed to onError and ignored. Nothing is watched if the file is not set.
+func Watch(onChange func(Config), onError func(error)) error {
+	path := os.Getenv(envConfigFile)
+	if path == "" {
+		return nil
 	}
-	if cfg.APIUrl == "" {
-		required("API_URL")
+
+	v := newViper()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		return fmt.Errorf("reading config file: %w", err)
 	}
-	if cfg.ClusterID == "" {
-		required("CLUSTER_ID")
+	v.OnConfigChange(func(fsnotify.Event) {
+		cfg, err := load(v)
+		if err != nil {
+			onError(err)
+			return
+		}
+		onChange(cfg)
+	})
+	v.WatchConfig()
+	return nil
+}
+
+func load(v *viper.Viper, overrides ...func(*Config)) (Config, error) {
+	var cfg Config
+	err := v.Unmarshal(&cfg, viper.DecodeHook(mapstructure.ComposeDecodeHookFunc(
+		mapstructure.StringToTimeDurationHookFunc(),
+		mapstructure.StringToSliceHookFunc(","),
+		jsonStringHook,
+	)))
+	if err != nil {
+		return Config{}, fmt.Errorf("parsing configuration: %w", err)
 	}
-	if cfg.NodeName == "" {
-		required("NODE_NAME")
+	for _, override := range overrides {
+		override(&cfg)
 	}
-	if cfg.Provider == "" {
-		required("PROVIDER")
+	if err := cfg.Validate(); err != nil {
+		return Config{}, err
 	}
+	return cfg, nil
+}
 
-	return *cfg
+// jsonStringHook allows lists and objects in the config file for settings passed as JSON in env variables, e.g.
+// drain groups.
+func jsonStringHook(from, to reflect.Type, data any) (any, error) {
+	if to.Kind() != reflect.String {
+		return data, nil
+	}
+	switch from.Kind() {
+	case reflect.Slice, reflect.Map:
+		b, err := json.Marshal(data)
+		if err != nil {
+			return nil, err
+		}
+		return string(b), nil
+	default:
+		return data, nil
+	}
 }
 
-func required(variable string) {
-	panic(fmt.Errorf("env variable %s is required", variable))
+func newViper() *viper.Viper {
+	v := viper.New()
+
+	_ = v.BindEnv("loglevel", "LOG_LEVEL")
+	v.SetDefault("loglevel", int(logrus.InfoLevel))
+
+	_ = v.BindEnv("apikey", "API_KEY")
+	_ = v.BindEnv("apikeyfile", "API_KEY_FILE")
+	_ = v.BindEnv("apiurl", "API_URL")
+	_ = v.BindEnv("tlscacert", "TLS_CA_CERT_FILE")
+	_ = v.BindEnv("tls.clientcertfile", "TLS_CLIENT_CERT_FILE")
+	_ = v.BindEnv("tls.clientkeyfile", "TLS_CLIENT_KEY_FILE")
+	_ = v.BindEnv("tls.minversion", "TLS_MIN_VERSION")
+	_ = v.BindEnv("tls.reloadintervalseconds", "TLS_RELOAD_INTERVAL_SECONDS")
+	v.SetDefault("tls.reloadintervalseconds", 60)
+	_ = v.BindEnv("kubeconfig", "KUBECONFIG")
+	_ = v.BindEnv("nodename", "NODE_NAME")
+	_ = v.BindEnv("clusterid", "CLUSTER_ID")
+	_ = v.BindEnv("provider", "PROVIDER")
+	_ = v.BindEnv("metadataurl", "METADATA_URL")
+
+	_ = v.BindEnv("pollintervalseconds", "POLL_INTERVAL_SECONDS")
+	_ = v.BindEnv("polltimeoutseconds", "POLL_TIMEOUT_SECONDS")
+	_ = v.BindEnv("shutdowngraceperiodseconds", "SHUTDOWN_GRACE_PERIOD_SECONDS")
+	v.SetDefault("polltimeoutseconds", 10)
+	v.SetDefault("shutdowngraceperiodseconds", 30)
+	_ = v.BindEnv("mothershipbatchwindowmillis", "MOTHERSHIP_BATCH_WINDOW_MILLIS")
+	_ = v.BindEnv("mothershipgzip", "MOTHERSHIP_GZIP")
+	v.SetDefault("mothershipbatchwindowmillis", 100)
+	_ = v.BindEnv("heartbeatintervalseconds", "HEARTBEAT_INTERVAL_SECONDS")
+	v.SetDefault("heartbeatintervalseconds", 60)
+	_ = v.BindEnv("pprofport", "PPROF_PORT")
+	_ = v.BindEnv("metricsport", "METRICS_PORT")
+	_ = v.BindEnv("simulationport", "SIMULATION_PORT")
+	_ = v.BindEnv("simulationtoken", "SIMULATION_TOKEN")
+
+	_ = v.BindEnv("phase2permissions", "PHASE2_PERMISSIONS")
+	_ = v.BindEnv("outofservicetaint", "OUT_OF_SERVICE_TAINT")
+	_ = v.BindEnv("dryrun", "DRY_RUN")
+	_ = v.BindEnv("standalone", "STANDALONE")
+
+	_ = v.BindEnv("webhook.url", "WEBHOOK_URL")
+	_ = v.BindEnv("webhook.secret", "WEBHOOK_SECRET")
+	_ = v.BindEnv("webhook.template", "WEBHOOK_TEMPLATE")
+	_ = v.BindEnv("webhook.timeoutseconds", "WEBHOOK_TIMEOUT_SECONDS")
+	_ = v.BindEnv("webhook.maxretries", "WEBHOOK_MAX_RETRIES")
+	v.SetDefault("webhook.timeoutseconds", 5)
+	v.SetDefault("webhook.maxretries", 5)
+
+	_ = v.BindEnv("annotatepods", "ANNOTATE_PODS")
+
+	_ = v.BindEnv("drain.enabled", "DRAIN_ENABLED")
+	_ = v.BindEnv("drain.groups", "DRAIN_GROUPS")
+	_ = v.BindEnv("drain.concurrency", "DRAIN_CONCURRENCY")
+	_ = v.BindEnv("drain.timeoutseconds", "DRAIN_TIMEOUT_SECONDS")
+	_ = v.BindEnv("drain.strategy", "DRAIN_STRATEGY")
+	_ = v.BindEnv("drain.minreadyreplicas", "DRAIN_MIN_READY_REPLICAS")
+	_ = v.BindEnv("drain.volumedetach", "DRAIN_VOLUME_DETACH")
+	v.SetDefault("drain.concurrency", 5)
+	v.SetDefault("drain.timeoutseconds", 120)
+
+	_ = v.BindEnv("hooks.pods", "PRE_TERMINATION_POD_HOOKS")
+	_ = v.BindEnv("hooks.commands", "PRE_TERMINATION_COMMANDS")
+	_ = v.BindEnv("hooks.timeoutseconds", "PRE_TERMINATION_HOOK_TIMEOUT_SECONDS")
+	v.SetDefault("hooks.timeoutseconds", 30)
+
+	_ = v.BindEnv("retryinitialintervalmillis", "RETRY_INITIAL_INTERVAL_MILLIS")
+	_ = v.BindEnv("retrymaxintervalseconds", "RETRY_MAX_INTERVAL_SECONDS")
+	_ = v.BindEnv("retrymaxelapsedseconds", "RETRY_MAX_ELAPSED_SECONDS")
+
+	return v
 }
@@ -0,0 +1,230 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoad(t *testing.T) {
+	setValidEnv := func(t *testing.T) {
+		t.Setenv("API_KEY", "key")
+		t.Setenv("API_URL", "https://api.cast.ai")
+		t.Setenv("CLUSTER_ID", "cluster")
+		t.Setenv("NODE_NAME", "node")
+		t.Setenv("PROVIDER", "aws")
+		t.Setenv("POLL_INTERVAL_SECONDS", "5")
+	}
+
+	t.Run("load valid configuration with defaults", func(t *testing.T) {
+		r := require.New(t)
+		setValidEnv(t)
+
+		cfg, err := Load()
+		r.NoError(err)
+		r.Equal("https://api.cast.ai", cfg.APIUrl)
+		r.Equal(5, cfg.PollIntervalSeconds)
+		r.Equal(10, cfg.PollTimeoutSeconds)
+		r.Equal(5, cfg.Drain.Concurrency)
+		r.Equal(60, cfg.HeartbeatIntervalSeconds)
+		r.Equal(100, cfg.MothershipBatchWindowMillis)
+		r.False(cfg.MothershipGzip)
+	})
+
+	t.Run("report all problems at once", func(t *testing.T) {
+		r := require.New(t)
+		setValidEnv(t)
+		t.Setenv("API_KEY", "")
+		t.Setenv("API_URL", "api.cast.ai")
+		t.Setenv("PROVIDER", "digitalocean")
+		t.Setenv("POLL_INTERVAL_SECONDS", "0")
+		t.Setenv("METRICS_PORT", "70000")
+		t.Setenv("SIMULATION_PORT", "6061")
+		t.Setenv("TLS_CA_CERT_FILE", "not a certificate")
+		t.Setenv("DRAIN_STRATEGY", "unknown")
+		t.Setenv("DRAIN_GROUPS", "{")
+
+		_, err := Load()
+		var validationErr *ValidationError
+		r.True(errors.As(err, &validationErr))
+
+		var fields []string
+		for _, fe := range validationErr.Errors {
+			fields = append(fields, fe.Field)
+		}
+		r.ElementsMatch([]string{
+			"API_KEY",
+			"API_URL",
+			"PROVIDER",
+			"POLL_INTERVAL_SECONDS",
+			"METRICS_PORT",
+			"SIMULATION_TOKEN",
+			"TLS_CA_CERT_FILE",
+			"DRAIN_STRATEGY",
+			"DRAIN_GROUPS",
+		}, fields)
+	})
+
+	t.Run("do not require mothership settings in standalone mode", func(t *testing.T) {
+		r := require.New(t)
+		setValidEnv(t)
+		t.Setenv("API_KEY", "")
+		t.Setenv("API_URL", "")
+		t.Setenv("CLUSTER_ID", "")
+		t.Setenv("STANDALONE", "true")
+
+		cfg, err := Load()
+		r.NoError(err)
+		r.True(cfg.Standalone)
+	})
+
+	t.Run("validate overrides", func(t *testing.T) {
+		r := require.New(t)
+		setValidEnv(t)
+		t.Setenv("NODE_NAME", "")
+
+		cfg, err := Load(func(cfg *Config) {
+			cfg.NodeName = "flag-node"
+		})
+		r.NoError(err)
+		r.Equal("flag-node", cfg.NodeName)
+
+		_, err = Load(func(cfg *Config) {
+			cfg.Provider = "unknown"
+		})
+		r.ErrorContains(err, "PROVIDER")
+	})
+
+	t.Run("read API key from file", func(t *testing.T) {
+		r := require.New(t)
+		setValidEnv(t)
+		path := filepath.Join(t.TempDir(), "api-key")
+		r.NoError(os.WriteFile(path, []byte("key"), 0o600))
+		t.Setenv("API_KEY", "")
+		t.Setenv("API_KEY_FILE", path)
+
+		cfg, err := Load()
+		r.NoError(err)
+		r.Equal(path, cfg.APIKeyFile)
+
+		t.Setenv("API_KEY_FILE", filepath.Join(t.TempDir(), "missing"))
+		_, err = Load()
+		r.ErrorContains(err, "API_KEY_FILE")
+	})
+
+	t.Run("reject unknown volume detach", func(t *testing.T) {
+		r := require.New(t)
+		setValidEnv(t)
+		t.Setenv("DRAIN_VOLUME_DETACH", "out-of-service")
+
+		_, err := Load()
+		r.ErrorContains(err, "DRAIN_VOLUME_DETACH")
+	})
+
+	t.Run("validate TLS settings", func(t *testing.T) {
+		r := require.New(t)
+		setValidEnv(t)
+		t.Setenv("TLS_CA_CERT_FILE", filepath.Join(t.TempDir(), "missing.pem"))
+		t.Setenv("TLS_CLIENT_CERT_FILE", "/etc/tls/tls.crt")
+		t.Setenv("TLS_MIN_VERSION", "1.1")
+
+		_, err := Load()
+		var validationErr *ValidationError
+		r.True(errors.As(err, &validationErr))
+
+		var fields []string
+		for _, fe := range validationErr.Errors {
+			fields = append(fields, fe.Field)
+		}
+		r.ElementsMatch([]string{"TLS_CA_CERT_FILE", "TLS_CLIENT_KEY_FILE", "TLS_MIN_VERSION"}, fields)
+	})
+
+	t.Run("return parsing errors", func(t *testing.T) {
+		r := require.New(t)
+		setValidEnv(t)
+		t.Setenv("POLL_INTERVAL_SECONDS", "often")
+
+		_, err := Load()
+		r.ErrorContains(err, "parsing configuration")
+	})
+}
+
+func TestConfigFile(t *testing.T) {
+	writeFile := func(t *testing.T, path, content string) {
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	}
+
+	t.Run("load settings from file with env overrides", func(t *testing.T) {
+		r := require.New(t)
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		writeFile(t, path, `
+apiKey: key
+apiUrl: https://api.cast.ai
+clusterId: cluster
+nodeName: node
+provider: gcp
+pollIntervalSeconds: 3
+dryRun: true
+webhook:
+  url: https://hooks.example.com
+drain:
+  enabled: true
+  groups:
+    - name: batch
+      priorityClassNames: [batch]
+`)
+		t.Setenv("CONFIG_FILE", path)
+		t.Setenv("PROVIDER", "aws")
+
+		cfg, err := Load()
+		r.NoError(err)
+		r.Equal("aws", cfg.Provider)
+		r.Equal(3, cfg.PollIntervalSeconds)
+		r.True(cfg.DryRun)
+		r.Equal("https://hooks.example.com", cfg.Webhook.URL)
+		r.True(cfg.Drain.Enabled)
+		// Keys are lowercased by viper, JSON decoding matches them case-insensitively.
+		var groups []struct {
+			Name               string   `json:"name"`
+			PriorityClassNames []string `json:"priorityClassNames"`
+		}
+		r.NoError(json.Unmarshal([]byte(cfg.Drain.Groups), &groups))
+		r.Len(groups, 1)
+		r.Equal("batch", groups[0].Name)
+		r.Equal([]string{"batch"}, groups[0].PriorityClassNames)
+	})
+
+	t.Run("reload changed file", func(t *testing.T) {
+		r := require.New(t)
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		base := "standalone: true\nnodeName: node\nprovider: aws\n"
+		writeFile(t, path, base+"pollIntervalSeconds: 5\n")
+		t.Setenv("CONFIG_FILE", path)
+
+		changes := make(chan Config, 10)
+		errs := make(chan error, 10)
+		r.NoError(Watch(func(cfg Config) { changes <- cfg }, func(err error) { errs <- err }))
+
+		writeFile(t, path, base+"pollIntervalSeconds: 0\n")
+		select {
+		case err := <-errs:
+			r.ErrorContains(err, "POLL_INTERVAL_SECONDS")
+		case <-time.After(5 * time.Second):
+			r.Fail("invalid configuration not reported")
+		}
+
+		writeFile(t, path, base+"pollIntervalSeconds: 1\ndryRun: true\n")
+		select {
+		case cfg := <-changes:
+			r.Equal(1, cfg.PollIntervalSeconds)
+			r.True(cfg.DryRun)
+		case <-time.After(5 * time.Second):
+			r.Fail("configuration not reloaded")
+		}
+	})
+}
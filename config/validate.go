@@ -0,0 +1,228 @@
+package config
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/castai/spot-handler/tlsutil"
+)
+
+// FieldError is a problem with a single setting, Field is the name of its env variable.
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+func (e FieldError) Error() string {
+	return e.Field + ": " + e.Message
+}
+
+// ValidationError aggregates all problems of the configuration.
+type ValidationError struct {
+	Errors []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, 0, len(e.Errors))
+	for _, fe := range e.Errors {
+		msgs = append(msgs, fe.Error())
+	}
+	return "invalid configuration: " + strings.Join(msgs, "; ")
+}
+
+type validator struct {
+	errs []FieldError
+}
+
+func (v *validator) fail(field, format string, args ...any) {
+	v.errs = append(v.errs, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) required(field, value string) bool {
+	if value == "" {
+		v.fail(field, "required")
+		return false
+	}
+	return true
+}
+
+func (v *validator) url(field, value string) {
+	u, err := url.Parse(value)
+	if err != nil {
+		v.fail(field, "invalid URL: %v", err)
+		return
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		v.fail(field, "invalid URL %q, expected absolute http or https URL", value)
+	}
+}
+
+func (v *validator) positive(field string, value int) {
+	if value <= 0 {
+		v.fail(field, "must be positive, got %d", value)
+	}
+}
+
+func (v *validator) nonNegative(field string, value int) {
+	if value < 0 {
+		v.fail(field, "must not be negative, got %d", value)
+	}
+}
+
+func (v *validator) port(field string, value int) {
+	if value < 0 || value > 65535 {
+		v.fail(field, "must be a port number between 1 and 65535 or 0 to disable, got %d", value)
+	}
+}
+
+func (v *validator) oneOf(field, value string, allowed ...string) {
+	for _, a := range allowed {
+		if value == a {
+			return
+		}
+	}
+	v.fail(field, "unknown value %q, expected one of: %s", value, strings.Join(allowed, ", "))
+}
+
+func (v *validator) readableFile(field, path string) ([]byte, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		v.fail(field, "not readable: %v", err)
+		return nil, false
+	}
+	return data, true
+}
+
+func (v *validator) jsonList(field, value string) {
+	var list []json.RawMessage
+	if err := json.Unmarshal([]byte(value), &list); err != nil {
+		v.fail(field, "invalid JSON list: %v", err)
+	}
+}
+
+// Validate checks all settings and returns *ValidationError listing every problem found.
+func (c Config) Validate() error {
+	v := &validator{}
+
+	if !c.Standalone {
+		switch {
+		case c.APIKey != "" && c.APIKeyFile != "":
+			v.fail("API_KEY_FILE", "only one of API_KEY and API_KEY_FILE can be set")
+		case c.APIKeyFile != "":
+			if data, err := os.ReadFile(c.APIKeyFile); err != nil {
+				v.fail("API_KEY_FILE", "not readable: %v", err)
+			} else if len(bytes.TrimSpace(data)) == 0 {
+				v.fail("API_KEY_FILE", "file is empty")
+			}
+		default:
+			v.required("API_KEY", c.APIKey)
+		}
+		if v.required("API_URL", c.APIUrl) {
+			v.url("API_URL", c.APIUrl)
+		}
+		v.required("CLUSTER_ID", c.ClusterID)
+	}
+	v.required("NODE_NAME", c.NodeName)
+	if v.required("PROVIDER", c.Provider) {
+		v.oneOf("PROVIDER", c.Provider, "aws", "gcp", "azure")
+	}
+	if c.MetadataURL != "" {
+		v.url("METADATA_URL", c.MetadataURL)
+	}
+	c.validateTLS(v)
+	if c.Kubeconfig != "" {
+		if _, err := os.Stat(c.Kubeconfig); err != nil {
+			v.fail("KUBECONFIG", "not readable: %v", err)
+		}
+	}
+	if c.LogLevel < int(logrus.PanicLevel) || c.LogLevel > int(logrus.TraceLevel) {
+		v.fail("LOG_LEVEL", "must be between %d and %d, got %d", logrus.PanicLevel, logrus.TraceLevel, c.LogLevel)
+	}
+
+	v.port("PPROF_PORT", c.PprofPort)
+	v.port("METRICS_PORT", c.MetricsPort)
+	v.port("SIMULATION_PORT", c.SimulationPort)
+	if c.SimulationPort != 0 {
+		v.required("SIMULATION_TOKEN", c.SimulationToken)
+	}
+
+	v.positive("POLL_INTERVAL_SECONDS", c.PollIntervalSeconds)
+	v.positive("POLL_TIMEOUT_SECONDS", c.PollTimeoutSeconds)
+	v.nonNegative("SHUTDOWN_GRACE_PERIOD_SECONDS", c.ShutdownGracePeriodSeconds)
+	v.nonNegative("HEARTBEAT_INTERVAL_SECONDS", c.HeartbeatIntervalSeconds)
+	v.nonNegative("MOTHERSHIP_BATCH_WINDOW_MILLIS", c.MothershipBatchWindowMillis)
+	v.nonNegative("RETRY_INITIAL_INTERVAL_MILLIS", c.RetryInitialIntervalMillis)
+	v.nonNegative("RETRY_MAX_INTERVAL_SECONDS", c.RetryMaxIntervalSeconds)
+	v.nonNegative("RETRY_MAX_ELAPSED_SECONDS", c.RetryMaxElapsedSeconds)
+
+	if c.Webhook.URL != "" {
+		v.url("WEBHOOK_URL", c.Webhook.URL)
+		v.positive("WEBHOOK_TIMEOUT_SECONDS", c.Webhook.TimeoutSeconds)
+		v.nonNegative("WEBHOOK_MAX_RETRIES", c.Webhook.MaxRetries)
+	}
+
+	if c.Hooks.Commands != "" {
+		v.jsonList("PRE_TERMINATION_COMMANDS", c.Hooks.Commands)
+	}
+	v.positive("PRE_TERMINATION_HOOK_TIMEOUT_SECONDS", c.Hooks.TimeoutSeconds)
+
+	if c.Drain.Groups != "" {
+		v.jsonList("DRAIN_GROUPS", c.Drain.Groups)
+	}
+	v.positive("DRAIN_CONCURRENCY", c.Drain.Concurrency)
+	v.positive("DRAIN_TIMEOUT_SECONDS", c.Drain.TimeoutSeconds)
+	v.nonNegative("DRAIN_MIN_READY_REPLICAS", c.Drain.MinReadyReplicas)
+	if c.Drain.Strategy != "" {
+		v.oneOf("DRAIN_STRATEGY", c.Drain.Strategy, "evict", "reschedule-aware")
+	}
+	if c.Drain.VolumeDetach != "" {
+		v.oneOf("DRAIN_VOLUME_DETACH", c.Drain.VolumeDetach, "delete-attachments")
+	}
+
+	if len(v.errs) > 0 {
+		return &ValidationError{Errors: v.errs}
+	}
+	return nil
+}
+
+func (c Config) validateTLS(v *validator) {
+	if c.TLSCACert != "" {
+		// CA is either passed inline or as a path to a file with it.
+		ca, ok := []byte(c.TLSCACert), true
+		if !tlsutil.IsPEM(c.TLSCACert) {
+			ca, ok = v.readableFile("TLS_CA_CERT_FILE", c.TLSCACert)
+		}
+		if ok && !x509.NewCertPool().AppendCertsFromPEM(ca) {
+			v.fail("TLS_CA_CERT_FILE", "no valid PEM certificates found")
+		}
+	}
+
+	switch {
+	case c.TLS.ClientCertFile == "" && c.TLS.ClientKeyFile == "":
+	case c.TLS.ClientCertFile == "":
+		v.fail("TLS_CLIENT_CERT_FILE", "required when TLS_CLIENT_KEY_FILE is set")
+	case c.TLS.ClientKeyFile == "":
+		v.fail("TLS_CLIENT_KEY_FILE", "required when TLS_CLIENT_CERT_FILE is set")
+	default:
+		cert, certOK := v.readableFile("TLS_CLIENT_CERT_FILE", c.TLS.ClientCertFile)
+		key, keyOK := v.readableFile("TLS_CLIENT_KEY_FILE", c.TLS.ClientKeyFile)
+		if certOK && keyOK {
+			if _, err := tls.X509KeyPair(cert, key); err != nil {
+				v.fail("TLS_CLIENT_CERT_FILE", "invalid certificate or key: %v", err)
+			}
+		}
+	}
+
+	if c.TLS.MinVersion != "" {
+		v.oneOf("TLS_MIN_VERSION", c.TLS.MinVersion, "1.2", "1.3")
+	}
+	v.nonNegative("TLS_RELOAD_INTERVAL_SECONDS", c.TLS.ReloadIntervalSeconds)
+}
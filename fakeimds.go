@@ -0,0 +1,49 @@
+package main
+
+import (
+	"flag"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+	"sigs.k8s.io/controller-runtime/pkg/manager/signals"
+
+	"github.com/castai/spot-handler/metadatafake"
+)
+
+// runFakeIMDS serves the fake metadata service of all providers, optionally playing notices from a timeline.
+func runFakeIMDS(args []string) {
+	fs := flag.NewFlagSet("fake-imds", flag.ExitOnError)
+	addr := fs.String("addr", ":1338", "address to listen on")
+	timeline := fs.String("timeline", "", "YAML or JSON file with timeline steps")
+	_ = fs.Parse(args)
+
+	log := logrus.WithFields(logrus.Fields{"command": "fake-imds"})
+	ctx := signals.SetupSignalHandler()
+
+	srv := metadatafake.New()
+
+	if *timeline != "" {
+		steps, err := metadatafake.LoadTimeline(*timeline)
+		if err != nil {
+			log.Fatalf("loading timeline: %v", err)
+		}
+		go func() {
+			if err := srv.Play(ctx, steps); err != nil {
+				log.Errorf("playing timeline: %v", err)
+				return
+			}
+			log.Infof("timeline finished")
+		}()
+	}
+
+	server := &http.Server{Addr: *addr, Handler: srv}
+	go func() {
+		<-ctx.Done()
+		_ = server.Close()
+	}()
+
+	log.Infof("serving fake metadata on %s", *addr)
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Fatalf("serving fake metadata: %v", err)
+	}
+}
@@ -2,13 +2,20 @@ package handler
 
 import (
 	"context"
+	"encoding/json"
+	"time"
 
 	"github.com/aws/aws-node-termination-handler/pkg/ec2metadata"
 )
 
-func NewAWSInterruptChecker() MetadataChecker {
+// NewAWSInterruptChecker checks for aws spot interrupt event from instance metadata service. Default metadata
+// service is used when metadataURL is empty.
+func NewAWSInterruptChecker(metadataURL string) MetadataChecker {
+	if metadataURL == "" {
+		metadataURL = "http://169.254.169.254"
+	}
 	return &awsInterruptChecker{
-		imds: ec2metadata.New("http://169.254.169.254", 3),
+		imds: ec2metadata.New(metadataURL, 3),
 	}
 }
 
@@ -27,11 +34,30 @@ func (c *awsInterruptChecker) CheckRebalanceRecommendation(_ context.Context) (b
 	return true, nil
 }
 
-func (c *awsInterruptChecker) CheckInterrupt(_ context.Context) (bool, error) {
+func (c *awsInterruptChecker) CheckInterrupt(ctx context.Context) (bool, error) {
+	notice, err := c.GetInterruptNotice(ctx)
+	return notice != nil, err
+}
+
+func (c *awsInterruptChecker) GetInterruptNotice(_ context.Context) (*InterruptNotice, error) {
 	instanceAction, err := c.imds.GetSpotITNEvent()
-	if instanceAction == nil && err == nil {
+	if err != nil {
+		return nil, err
+	}
+	if instanceAction == nil {
 		// if there are no spot itns and no errors
-		return false, nil
+		return nil, nil
+	}
+
+	notice := &InterruptNotice{
+		Action: instanceAction.Action,
+		Status: NoticeStatusScheduled,
+	}
+	if t, err := time.Parse(time.RFC3339, instanceAction.Time); err == nil {
+		notice.Time = t
+	}
+	if raw, err := json.Marshal(instanceAction); err == nil {
+		notice.Raw = raw
 	}
-	return true, err
+	return notice, nil
 }
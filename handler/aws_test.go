@@ -2,38 +2,20 @@ package handler
 
 import (
 	"context"
-	"encoding/json"
-	"fmt"
-	"net/http"
 	"net/http/httptest"
 	"testing"
 	"time"
 
 	"github.com/aws/aws-node-termination-handler/pkg/ec2metadata"
 	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/castai/spot-handler/metadatafake"
 )
 
 func TestAwsInterruptChecker(t *testing.T) {
-	router := http.NewServeMux()
-	router.HandleFunc("/latest/api/token", func(writer http.ResponseWriter, request *http.Request) {
-
-		writer.Header().Set("X-aws-ec2-metadata-token-ttl-seconds", "1000")
-		fmt.Fprintf(writer, "TOKEN")
-	})
-	router.HandleFunc("/latest/meta-data/spot/instance-action", func(writer http.ResponseWriter, request *http.Request) {
-		action := ec2metadata.InstanceAction{
-			Action: "SPOT_INT",
-			Time:   time.Now().Format(time.RFC3339),
-		}
-		b, err := json.Marshal(action)
-		require.NoError(t, err)
-
-		writer.Header().Set("Content-Type", "application/json")
-		writer.WriteHeader(http.StatusOK)
-		_, err = writer.Write(b)
-		require.NoError(t, err)
-	})
-	s := httptest.NewServer(router)
+	imds := metadatafake.New()
+	s := httptest.NewServer(imds)
 	defer s.Close()
 
 	checker := awsInterruptChecker{
@@ -42,5 +24,21 @@ func TestAwsInterruptChecker(t *testing.T) {
 
 	interrupted, err := checker.CheckInterrupt(context.Background())
 	require.NoError(t, err)
+	require.False(t, interrupted)
+
+	require.NoError(t, imds.Apply(metadatafake.Step{
+		Type:     metadatafake.TypeInterrupted,
+		NoticeIn: metav1.Duration{Duration: time.Minute},
+	}))
+
+	interrupted, err = checker.CheckInterrupt(context.Background())
+	require.NoError(t, err)
 	require.True(t, interrupted)
+
+	notice, err := checker.GetInterruptNotice(context.Background())
+	require.NoError(t, err)
+	require.NotNil(t, notice)
+	require.Equal(t, "terminate", notice.Action)
+	require.WithinDuration(t, time.Now().Add(time.Minute), notice.Time, 2*time.Second)
+	require.Contains(t, string(notice.Raw), `"action":"terminate"`)
 }
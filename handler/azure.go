@@ -2,6 +2,7 @@ package handler
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"time"
 
@@ -10,14 +11,18 @@ import (
 
 // NewAzureInterruptChecker checks for azure spot interrupt event from metadata server.
 // See https://docs.microsoft.com/en-us/azure/virtual-machines/linux/scheduled-events#endpoint-discovery
-func NewAzureInterruptChecker() MetadataChecker {
+// Default metadata server is used when metadataURL is empty.
+func NewAzureInterruptChecker(metadataURL string) MetadataChecker {
 	client := resty.New()
 	// Times out if set to 1 second, after 2 we will try again soon anyway
 	client.SetTimeout(time.Second * 2)
 
+	if metadataURL == "" {
+		metadataURL = "http://169.254.169.254"
+	}
 	return &azureInterruptChecker{
 		client:            client,
-		metadataServerURL: "http://169.254.169.254",
+		metadataServerURL: metadataURL,
 	}
 }
 
@@ -27,33 +32,62 @@ type azureInterruptChecker struct {
 }
 
 type azureSpotScheduledEvent struct {
-	EventType string
+	EventType   string
+	EventStatus string
+	NotBefore   string
 }
 type azureSpotScheduledEvents struct {
-	Events []azureSpotScheduledEvent
+	// Events are decoded one by one to keep raw event for cloud events.
+	Events []json.RawMessage
 }
 
 func (c *azureInterruptChecker) CheckInterrupt(ctx context.Context) (bool, error) {
+	notice, err := c.GetInterruptNotice(ctx)
+	return notice != nil, err
+}
+
+func (c *azureInterruptChecker) GetInterruptNotice(ctx context.Context) (*InterruptNotice, error) {
 	responseBody := azureSpotScheduledEvents{}
 
 	req := c.client.NewRequest().SetContext(ctx).SetResult(&responseBody)
 	req.SetHeader("Metadata", "true")
 	resp, err := req.Get(fmt.Sprintf("%s/metadata/scheduledevents?api-version=2020-07-01", c.metadataServerURL))
 	if err != nil {
-		return false, fmt.Errorf("getting metadata/preemtied: %w", err)
+		return nil, fmt.Errorf("getting metadata/scheduledevents: %w", err)
 	}
 
 	if resp.StatusCode() != 200 {
-		return false, fmt.Errorf("received unexpected status code: %d", resp.StatusCode())
+		return nil, fmt.Errorf("received unexpected status code: %d", resp.StatusCode())
 	}
 
-	for _, e := range responseBody.Events {
-		if e.EventType == "Preempt" {
-			return true, nil
+	for _, raw := range responseBody.Events {
+		var e azureSpotScheduledEvent
+		if err := json.Unmarshal(raw, &e); err != nil {
+			return nil, fmt.Errorf("decoding scheduled event: %w", err)
 		}
+		if e.EventType != "Preempt" {
+			continue
+		}
+
+		notice := &InterruptNotice{
+			Action: e.EventType,
+			Status: NoticeStatusScheduled,
+			Raw:    raw,
+		}
+		switch e.EventStatus {
+		case "Started":
+			notice.Status = NoticeStatusStarted
+		case "Completed":
+			notice.Status = NoticeStatusCompleted
+		}
+		// NotBefore is empty once the event has started.
+		if t, err := time.Parse(time.RFC1123, e.NotBefore); err == nil {
+			notice.Time = t
+		}
+		return notice, nil
 	}
 
-	return false, nil
+	return nil, nil
 }
 
 func (c *azureInterruptChecker) CheckRebalanceRecommendation(ctx context.Context) (bool, error) {
@@ -5,30 +5,26 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/go-resty/resty/v2"
+	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/castai/spot-handler/castai"
+	"github.com/castai/spot-handler/metadatafake"
 )
 
 func TestAzureInterruptChecker(t *testing.T) {
+	metadata := metadatafake.New()
 	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		require.Equal(t, "/metadata/scheduledevents?api-version=2020-07-01", r.URL.String())
-
-		mockInterrupt := azureSpotScheduledEvent{
-			EventType: "Preempt",
-		}
-		eventsWrapper := azureSpotScheduledEvents{
-			Events: []azureSpotScheduledEvent{mockInterrupt},
-		}
-
-		b, err := json.Marshal(eventsWrapper)
-		require.NoError(t, err)
-
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		_, err = w.Write(b)
-		require.NoError(t, err)
+		metadata.ServeHTTP(w, r)
 	}))
 	defer s.Close()
 
@@ -39,5 +35,88 @@ func TestAzureInterruptChecker(t *testing.T) {
 
 	interrupted, err := checker.CheckInterrupt(context.Background())
 	require.NoError(t, err)
+	require.False(t, interrupted)
+
+	require.NoError(t, metadata.Apply(metadatafake.Step{
+		Type:     metadatafake.TypeInterrupted,
+		NoticeIn: metav1.Duration{Duration: time.Minute},
+	}))
+
+	interrupted, err = checker.CheckInterrupt(context.Background())
+	require.NoError(t, err)
 	require.True(t, interrupted)
+
+	notice, err := checker.GetInterruptNotice(context.Background())
+	require.NoError(t, err)
+	require.NotNil(t, notice)
+	require.Equal(t, NoticeStatusScheduled, notice.Status)
+	require.WithinDuration(t, time.Now().Add(time.Minute), notice.Time, 2*time.Second)
+	require.Contains(t, string(notice.Raw), `"EventType":"Preempt"`)
+
+	require.NoError(t, metadata.Apply(metadatafake.Step{
+		Type:   metadatafake.TypeInterrupted,
+		Status: metadatafake.StatusStarted,
+	}))
+
+	notice, err = checker.GetInterruptNotice(context.Background())
+	require.NoError(t, err)
+	require.NotNil(t, notice)
+	require.Equal(t, NoticeStatusStarted, notice.Status)
+	require.True(t, notice.Time.IsZero())
+
+	require.NoError(t, metadata.Apply(metadatafake.Step{
+		Type:   metadatafake.TypeInterrupted,
+		Status: metadatafake.StatusCompleted,
+	}))
+
+	notice, err = checker.GetInterruptNotice(context.Background())
+	require.NoError(t, err)
+	require.NotNil(t, notice)
+	require.Equal(t, NoticeStatusCompleted, notice.Status)
+}
+
+func TestAzureInterruptionCompletedWithMetadataServer(t *testing.T) {
+	r := require.New(t)
+	log := logrus.New()
+
+	metadata := metadatafake.New()
+	s := httptest.NewServer(metadata)
+	defer s.Close()
+
+	var mu sync.Mutex
+	var events []string
+	castS := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, re *http.Request) {
+		var req castai.CloudEventRequest
+		r.NoError(json.NewDecoder(re.Body).Decode(&req))
+		mu.Lock()
+		events = append(events, req.EventType)
+		mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer castS.Close()
+	castHttp, err := castai.NewRestyClient(castS.URL, "test", castai.TLSConfig{}, log.Level, 100*time.Millisecond, "0.0.0")
+	r.NoError(err)
+
+	handler := SpotHandler{
+		pollWaitInterval: 50 * time.Millisecond,
+		metadataChecker:  &azureInterruptChecker{client: resty.New(), metadataServerURL: s.URL},
+		castClient:       castai.NewClient(log, castHttp, "test1", castai.BatchConfig{}),
+		nodeName:         "AI",
+		clientset:        fake.NewSimpleClientset(&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "AI"}}),
+		log:              log,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 600*time.Millisecond)
+	defer cancel()
+	go func() {
+		_ = metadata.Play(ctx, []metadatafake.Step{
+			{Type: metadatafake.TypeInterrupted},
+			{After: metav1.Duration{Duration: 200 * time.Millisecond}, Type: metadatafake.TypeInterrupted, Status: metadatafake.StatusCompleted},
+		})
+	}()
+
+	r.NoError(handler.Run(ctx))
+	mu.Lock()
+	defer mu.Unlock()
+	r.Equal([]string{cloudEventInterrupted, cloudEventInterruptionCompleted}, events)
 }
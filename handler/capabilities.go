@@ -0,0 +1,107 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/cenkalti/backoff/v4"
+	v1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/events"
+	"k8s.io/client-go/tools/record"
+
+	"github.com/castai/spot-handler/version"
+)
+
+const eventsComponent = "castai-spot-handler"
+
+func (g *SpotHandler) capabilities() version.Capabilities {
+	return version.CapabilitiesOf(g.k8sVersion)
+}
+
+// applyOrPatch applies cfg using server-side apply. On clusters not supporting it, the fields set by the handler are
+// sent as a strategic merge patch.
+func (g *SpotHandler) applyOrPatch(cfg any, apply func() error, patch func(data []byte) error) error {
+	if g.capabilities().ServerSideApply {
+		return apply()
+	}
+	data, err := mergePatch(cfg)
+	if err != nil {
+		return backoff.Permanent(err)
+	}
+	return patch(data)
+}
+
+// mergePatch returns the fields set in the apply configuration without the type and object identity, which apply
+// requires but a patch of the same object doesn't.
+func mergePatch(cfg any) ([]byte, error) {
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("marshaling patch: %w", err)
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, fmt.Errorf("marshaling patch: %w", err)
+	}
+	delete(fields, "apiVersion")
+	delete(fields, "kind")
+	if meta, ok := fields["metadata"].(map[string]any); ok {
+		delete(meta, "name")
+		delete(meta, "namespace")
+		if len(meta) == 0 {
+			delete(fields, "metadata")
+		}
+	}
+	data, err = json.Marshal(fields)
+	if err != nil {
+		return nil, fmt.Errorf("marshaling patch: %w", err)
+	}
+	return data, nil
+}
+
+func (g *SpotHandler) evict(ctx context.Context, pod *v1.Pod) error {
+	meta := metav1.ObjectMeta{Name: pod.Name, Namespace: pod.Namespace}
+	if g.capabilities().EvictionV1 {
+		return g.clientset.PolicyV1().Evictions(pod.Namespace).Evict(ctx, &policyv1.Eviction{ObjectMeta: meta})
+	}
+	return g.clientset.PolicyV1beta1().Evictions(pod.Namespace).Evict(ctx, &policyv1beta1.Eviction{ObjectMeta: meta})
+}
+
+// NewEventRecorder returns recorder sending events to the API server in the background, using events.k8s.io/v1 API if
+// supported by the cluster. The returned func stops the recorder once queued events are sent.
+func NewEventRecorder(clientset kubernetes.Interface, k8sVersion version.Interface, nodeName string) (record.EventRecorder, func()) {
+	if version.CapabilitiesOf(k8sVersion).EventsV1 {
+		broadcaster := events.NewBroadcaster(&events.EventSinkImpl{Interface: clientset.EventsV1()})
+		broadcaster.StartRecordingToSink(nil)
+		return &eventsV1Recorder{recorder: broadcaster.NewRecorder(scheme.Scheme, eventsComponent)}, broadcaster.Shutdown
+	}
+
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: clientset.CoreV1().Events("")})
+	return broadcaster.NewRecorder(scheme.Scheme, v1.EventSource{Component: eventsComponent, Host: nodeName}), broadcaster.Shutdown
+}
+
+// eventsV1Recorder adapts events.k8s.io/v1 recorder to the core/v1 recorder interface used by the handler. Event
+// reason is reported as the action.
+type eventsV1Recorder struct {
+	recorder events.EventRecorder
+}
+
+func (r *eventsV1Recorder) Event(object runtime.Object, eventtype, reason, message string) {
+	r.recorder.Eventf(object, nil, eventtype, reason, reason, "%s", message)
+}
+
+func (r *eventsV1Recorder) Eventf(object runtime.Object, eventtype, reason, messageFmt string, args ...interface{}) {
+	r.recorder.Eventf(object, nil, eventtype, reason, reason, messageFmt, args...)
+}
+
+func (r *eventsV1Recorder) AnnotatedEventf(object runtime.Object, _ map[string]string, eventtype, reason, messageFmt string, args ...interface{}) {
+	r.recorder.Eventf(object, nil, eventtype, reason, reason, messageFmt, args...)
+}
@@ -0,0 +1,68 @@
+package handler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	ktest "k8s.io/client-go/testing"
+)
+
+func TestLegacyClusterCapabilities(t *testing.T) {
+	r := require.New(t)
+	log := logrus.New()
+	nodeName := "AI"
+
+	fakeApi := fake.NewSimpleClientset(
+		&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: nodeName}},
+		newDrainPod("pod", 0),
+	)
+	var evictions []runtime.Object
+	fakeApi.PrependReactor("create", "pods", func(action ktest.Action) (bool, runtime.Object, error) {
+		if action.GetSubresource() != "eviction" {
+			return false, nil, nil
+		}
+		eviction := action.(ktest.CreateAction).GetObject()
+		evictions = append(evictions, eviction)
+		return true, nil, fakeApi.Tracker().Delete(v1.SchemeGroupVersion.WithResource("pods"), "default", "pod")
+	})
+
+	handler := SpotHandler{
+		clientset:         fakeApi,
+		nodeName:          nodeName,
+		log:               log,
+		phase2Permissions: true,
+		drain:             DrainConfig{Enabled: true},
+		k8sVersion:        testVersion(21),
+	}
+	handler.drainNode(context.Background(), &InterruptNotice{Time: time.Now().Add(time.Minute)})
+
+	r.Len(evictions, 1)
+	r.IsType(&policyv1beta1.Eviction{}, evictions[0])
+
+	var patchTypes []types.PatchType
+	var patches []string
+	for _, action := range fakeApi.Actions() {
+		if patch, ok := action.(ktest.PatchAction); ok {
+			patchTypes = append(patchTypes, patch.GetPatchType())
+			patches = append(patches, string(patch.GetPatch()))
+		}
+	}
+	r.Equal([]types.PatchType{types.StrategicMergePatchType, types.StrategicMergePatchType}, patchTypes)
+	// Only the fields set by the handler are patched.
+	r.JSONEq(`{"metadata":{"labels":{"`+labelNodeDraining+`":"`+valueNodeDrainingReasonInterrupted+`"}},"spec":{"unschedulable":true}}`, patches[1])
+
+	got, err := fakeApi.CoreV1().Nodes().Get(context.Background(), nodeName, metav1.GetOptions{})
+	r.NoError(err)
+	r.True(got.Spec.Unschedulable)
+	r.Equal(valueNodeDrainingReasonInterrupted, got.Labels[labelNodeDraining])
+	r.Equal([]v1.Taint{drainingTaint()}, got.Spec.Taints)
+}
@@ -0,0 +1,93 @@
+package handler
+
+import (
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/utils/ptr"
+
+	"github.com/castai/spot-handler/castai"
+)
+
+// nodePoolLabels identify the node pool of managed node groups, the first one set on the node is reported.
+var nodePoolLabels = []string{
+	"scheduling.cast.ai/node-template",
+	"eks.amazonaws.com/nodegroup",
+	"cloud.google.com/gke-nodepool",
+	"kubernetes.azure.com/agentpool",
+	"karpenter.sh/nodepool",
+}
+
+// cloudEventLabels are node labels reported in cloud events in addition to nodePoolLabels.
+var cloudEventLabels = []string{
+	v1.LabelInstanceTypeStable,
+	v1.LabelTopologyZone,
+	v1.LabelTopologyRegion,
+	v1.LabelArchStable,
+	v1.LabelOSStable,
+	"scheduling.cast.ai/spot",
+	"scheduling.cast.ai/spot-fallback",
+	"karpenter.sh/capacity-type",
+	"eks.amazonaws.com/capacityType",
+	"cloud.google.com/gke-spot",
+	"cloud.google.com/gke-preemptible",
+	"kubernetes.azure.com/scalesetpriority",
+}
+
+func (g *SpotHandler) cloudEventHandler() *castai.CloudEventHandler {
+	h := &castai.CloudEventHandler{
+		Version:  g.handlerVersion,
+		Provider: g.provider,
+	}
+	if g.k8sVersion != nil {
+		h.KubernetesVersion = g.k8sVersion.Full()
+	}
+	return h
+}
+
+func cloudEventNode(node *v1.Node) *castai.CloudEventNode {
+	n := &castai.CloudEventNode{
+		Name:         node.Name,
+		InstanceType: node.Labels[v1.LabelInstanceTypeStable],
+		Zone:         node.Labels[v1.LabelTopologyZone],
+		Region:       node.Labels[v1.LabelTopologyRegion],
+	}
+	for _, key := range nodePoolLabels {
+		if value, ok := node.Labels[key]; ok {
+			if n.NodePool == "" {
+				n.NodePool = value
+			}
+			setLabel(n, key, value)
+		}
+	}
+	for _, key := range cloudEventLabels {
+		if value, ok := node.Labels[key]; ok {
+			setLabel(n, key, value)
+		}
+	}
+	return n
+}
+
+func setLabel(n *castai.CloudEventNode, key, value string) {
+	if n.Labels == nil {
+		n.Labels = map[string]string{}
+	}
+	n.Labels[key] = value
+}
+
+func cloudEventNotice(notice *InterruptNotice) *castai.CloudEventNotice {
+	if notice == nil {
+		return nil
+	}
+	n := &castai.CloudEventNotice{
+		Action:                 notice.Action,
+		Status:                 notice.Status,
+		DetectionLatencyMillis: notice.DetectionLatency.Milliseconds(),
+		Raw:                    notice.Raw,
+	}
+	if !notice.Time.IsZero() {
+		n.Time = ptr.To(notice.Time.UTC())
+	}
+	if !notice.DetectedAt.IsZero() {
+		n.DetectedAt = ptr.To(notice.DetectedAt.UTC())
+	}
+	return n
+}
@@ -0,0 +1,107 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/castai/spot-handler/castai"
+)
+
+func TestCloudEventPayload(t *testing.T) {
+	r := require.New(t)
+	log := logrus.New()
+	nodeName := "AI"
+	castNodeID := "CAST"
+	terminationTime := time.Now().Add(time.Minute).UTC().Truncate(time.Second)
+
+	var mu sync.Mutex
+	var requests []castai.CloudEventRequest
+	castS := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, re *http.Request) {
+		var req castai.CloudEventRequest
+		r.NoError(json.NewDecoder(re.Body).Decode(&req))
+		mu.Lock()
+		requests = append(requests, req)
+		mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer castS.Close()
+
+	castHttp, err := castai.NewRestyClient(castS.URL, "test", castai.TLSConfig{}, log.Level, 100*time.Millisecond, "0.0.0")
+	r.NoError(err)
+
+	fakeApi := fake.NewSimpleClientset(&v1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: nodeName,
+			Labels: map[string]string{
+				CastNodeIDLabel:                 castNodeID,
+				v1.LabelInstanceTypeStable:      "m5.large",
+				v1.LabelTopologyZone:            "eu-central-1a",
+				v1.LabelTopologyRegion:          "eu-central-1",
+				"eks.amazonaws.com/nodegroup":   "spot",
+				"karpenter.sh/capacity-type":    "spot",
+				"team.example.com/not-reported": "value",
+			},
+		},
+	})
+	handler := SpotHandler{
+		pollWaitInterval: 50 * time.Millisecond,
+		metadataChecker: &mockNoticeChecker{notices: []*InterruptNotice{
+			nil,
+			{Action: "terminate", Status: NoticeStatusScheduled, Time: terminationTime, Raw: json.RawMessage(`{"action":"terminate"}`)},
+		}},
+		castClient:     castai.NewClient(log, castHttp, "test1", castai.BatchConfig{}),
+		nodeName:       nodeName,
+		clientset:      fakeApi,
+		log:            log,
+		k8sVersion:     testVersion(29),
+		handlerVersion: "v1.2.3",
+		provider:       "aws",
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	r.NoError(handler.Run(ctx))
+
+	mu.Lock()
+	defer mu.Unlock()
+	r.Len(requests, 1)
+	req := requests[0]
+	r.Equal(cloudEventInterrupted, req.EventType)
+	r.Equal(castNodeID, req.NodeID)
+	r.Equal(castai.CloudEventSchemaVersion, req.SchemaVersion)
+	r.Equal(&castai.CloudEventNode{
+		Name:         nodeName,
+		InstanceType: "m5.large",
+		Zone:         "eu-central-1a",
+		Region:       "eu-central-1",
+		NodePool:     "spot",
+		Labels: map[string]string{
+			v1.LabelInstanceTypeStable:    "m5.large",
+			v1.LabelTopologyZone:          "eu-central-1a",
+			v1.LabelTopologyRegion:        "eu-central-1",
+			"eks.amazonaws.com/nodegroup": "spot",
+			"karpenter.sh/capacity-type":  "spot",
+		},
+	}, req.Node)
+	r.Equal(&castai.CloudEventHandler{Version: "v1.2.3", Provider: "aws", KubernetesVersion: "1.29"}, req.Handler)
+
+	r.NotNil(req.Notice)
+	r.Equal("terminate", req.Notice.Action)
+	r.Equal(NoticeStatusScheduled, req.Notice.Status)
+	r.Equal(terminationTime, req.Notice.Time.UTC())
+	r.NotNil(req.Notice.DetectedAt)
+	// Notice is seen by the second poll, one interval after the first one which didn't see it.
+	r.GreaterOrEqual(req.Notice.DetectionLatencyMillis, int64(40))
+	r.JSONEq(`{"action":"terminate"}`, string(req.Notice.Raw))
+}
@@ -0,0 +1,360 @@
+package handler
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/utils/ptr"
+
+	"github.com/castai/spot-handler/metrics"
+)
+
+const (
+	DrainGroupStateless = "stateless"
+	DrainGroupStateful  = "stateful"
+	DrainGroupCritical  = "critical"
+	// drainGroupOther holds pods not matching any configured group, it's drained last.
+	drainGroupOther = "other"
+
+	// systemCriticalPriority is the lowest priority of system-cluster-critical and system-node-critical classes.
+	systemCriticalPriority = 2000000000
+
+	defaultDrainConcurrency = 5
+	defaultDrainTimeout     = 2 * time.Minute
+
+	podDeletionPollInterval = 500 * time.Millisecond
+
+	eventReasonDrainIncomplete = "SpotDrainIncomplete"
+)
+
+// DrainConfig configures eviction of pods from the interrupted node.
+type DrainConfig struct {
+	Enabled bool
+	// Groups are drained one after another in the given order. Pod belongs to the first group it matches.
+	Groups []DrainGroup
+	// Concurrency limits evictions in progress within a group, unless overridden by the group.
+	Concurrency int
+	// Timeout bounds draining when the notice doesn't report the interruption time.
+	Timeout time.Duration
+	// Strategy is one of DrainStrategy* values, defaults to DrainStrategyEvict.
+	Strategy string
+	// MinReadyReplicas is the number of ready replicas on other nodes awaited by DrainStrategyRescheduleAware.
+	MinReadyReplicas int
+	// VolumeDetach is one of VolumeDetach* values run after the node is drained, empty disables it.
+	VolumeDetach string
+}
+
+// DrainGroup selects pods drained together. Empty selectors match all pods.
+type DrainGroup struct {
+	Name               string   `json:"name"`
+	PriorityClassNames []string `json:"priorityClassNames,omitempty"`
+	MinPriority        *int32   `json:"minPriority,omitempty"`
+	MaxPriority        *int32   `json:"maxPriority,omitempty"`
+	// Stateful matches pods owned by a StatefulSet or using persistent volume claims.
+	Stateful    *bool `json:"stateful,omitempty"`
+	Concurrency int   `json:"concurrency,omitempty"`
+	// BudgetWeight is the share of the time left until the interruption given to the group, relative to the
+	// weights of the following groups. Defaults to 1.
+	BudgetWeight int `json:"budgetWeight,omitempty"`
+}
+
+// DefaultDrainGroups drains stateless pods first, then stateful and system critical pods last.
+func DefaultDrainGroups() []DrainGroup {
+	return []DrainGroup{
+		{Name: DrainGroupStateless, Stateful: ptr.To(false), MaxPriority: ptr.To[int32](systemCriticalPriority - 1)},
+		{Name: DrainGroupStateful, Stateful: ptr.To(true), MaxPriority: ptr.To[int32](systemCriticalPriority - 1)},
+		{Name: DrainGroupCritical},
+	}
+}
+
+func (c DrainConfig) withDefaults() DrainConfig {
+	if len(c.Groups) == 0 {
+		c.Groups = DefaultDrainGroups()
+	}
+	if c.Concurrency <= 0 {
+		c.Concurrency = defaultDrainConcurrency
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = defaultDrainTimeout
+	}
+	return c
+}
+
+func (grp DrainGroup) matches(pod *v1.Pod) bool {
+	if len(grp.PriorityClassNames) > 0 && !slices.Contains(grp.PriorityClassNames, pod.Spec.PriorityClassName) {
+		return false
+	}
+	priority := podPriority(pod)
+	if grp.MinPriority != nil && priority < *grp.MinPriority {
+		return false
+	}
+	if grp.MaxPriority != nil && priority > *grp.MaxPriority {
+		return false
+	}
+	if grp.Stateful != nil && *grp.Stateful != isStateful(pod) {
+		return false
+	}
+	return true
+}
+
+type drainStep struct {
+	group DrainGroup
+	pods  []v1.Pod
+}
+
+// drainPlan assigns pods to groups, pods within a group are ordered by priority. Empty groups are skipped.
+func drainPlan(pods []v1.Pod, groups []DrainGroup) []drainStep {
+	steps := make([]drainStep, len(groups)+1)
+	for i, grp := range groups {
+		steps[i].group = grp
+	}
+	steps[len(groups)].group = DrainGroup{Name: drainGroupOther}
+
+	for _, pod := range pods {
+		if !isEvictable(&pod) {
+			continue
+		}
+		i := len(groups)
+		for j, grp := range groups {
+			if grp.matches(&pod) {
+				i = j
+				break
+			}
+		}
+		steps[i].pods = append(steps[i].pods, pod)
+	}
+
+	plan := make([]drainStep, 0, len(steps))
+	for _, s := range steps {
+		if len(s.pods) == 0 {
+			continue
+		}
+		sort.SliceStable(s.pods, func(i, j int) bool {
+			return podPriority(&s.pods[i]) < podPriority(&s.pods[j])
+		})
+		plan = append(plan, s)
+	}
+	return plan
+}
+
+// drainNode cordons the node and evicts its pods group by group. Each group gets its share of the time left until
+// the interruption, the next group is started once pods of the previous one are gone or its budget is spent.
+func (g *SpotHandler) drainNode(ctx context.Context, notice *InterruptNotice) {
+	if !g.drain.Enabled {
+		return
+	}
+	if !g.phase2Permissions {
+		g.log.Info("skipping node drain, phase2 permissions not enabled")
+		return
+	}
+	cfg := g.drain.withDefaults()
+
+	deadline := time.Now().Add(cfg.Timeout)
+	if notice != nil && notice.Time.After(time.Now()) {
+		deadline = notice.Time
+	}
+	// Volume detach runs on its own context bounded by the deadline, so that it gets the reserved time even when
+	// evictions use up all of their budget.
+	detachCtx, cancelDetach := context.WithDeadline(context.WithoutCancel(ctx), deadline)
+	defer cancelDetach()
+	if g.drain.VolumeDetach != "" {
+		deadline = deadline.Add(-min(volumeDetachReserve, time.Until(deadline)/4))
+	}
+	ctx, cancel := context.WithDeadline(detachCtx, deadline)
+	defer cancel()
+
+	node, err := g.getNode(ctx)
+	if err != nil {
+		g.log.Errorf("draining node: %v", err)
+		return
+	}
+	// Node is cordoned again, as the mothership notification preceding the taint may still be retried.
+	if err := g.taintNode(ctx, node); err != nil {
+		g.log.Errorf("draining node: %v", err)
+		return
+	}
+
+	pods, err := g.listNodePods(ctx)
+	if err != nil {
+		g.log.Errorf("draining node: %v", err)
+		return
+	}
+	plan := drainPlan(pods, cfg.Groups)
+
+	if g.isDryRun() {
+		for _, step := range plan {
+			g.log.Infof("dry-run: would evict %d pods of drain group %s: %v", len(step.pods), step.group.Name, podNames(step.pods))
+		}
+		metrics.DryRunAction(operationEvictPod)
+		g.detachVolumes(detachCtx, node)
+		return
+	}
+
+	var r *rescheduler
+	if cfg.Strategy == DrainStrategyRescheduleAware {
+		r = newRescheduler(g, cfg.MinReadyReplicas)
+	}
+
+	for i, step := range plan {
+		weightLeft := 0
+		for _, s := range plan[i:] {
+			weightLeft += budgetWeight(s.group)
+		}
+		budget := time.Until(deadline) * time.Duration(budgetWeight(step.group)) / time.Duration(weightLeft)
+
+		concurrency := step.group.Concurrency
+		if concurrency <= 0 {
+			concurrency = cfg.Concurrency
+		}
+
+		g.log.Infof("evicting %d pods of drain group %s, budget %s", len(step.pods), step.group.Name, budget.Round(time.Second))
+		remaining := g.drainGroup(ctx, r, step.pods, concurrency, budget)
+		if len(remaining) > 0 {
+			g.log.Warnf("pods of drain group %s not evicted within budget: %v", step.group.Name, remaining)
+			g.recordNodeEvent(node, v1.EventTypeWarning, eventReasonDrainIncomplete, "Pods of drain group %s not evicted within budget: %v", step.group.Name, remaining)
+		}
+	}
+
+	g.detachVolumes(detachCtx, node)
+}
+
+// drainGroup evicts pods with limited concurrency and waits for them to be deleted. Names of pods still present
+// after the budget is spent are returned. Evictions wait for replacement pods if r is set, waiting pods don't count
+// towards the concurrency so that other pods are evicted in the meantime.
+func (g *SpotHandler) drainGroup(ctx context.Context, r *rescheduler, pods []v1.Pod, concurrency int, budget time.Duration) []string {
+	ctx, cancel := context.WithTimeout(ctx, budget)
+	defer cancel()
+
+	var (
+		mu        sync.Mutex
+		remaining []string
+		wg        sync.WaitGroup
+	)
+	notEvicted := func(pod *v1.Pod) {
+		mu.Lock()
+		remaining = append(remaining, pod.Namespace+"/"+pod.Name)
+		mu.Unlock()
+	}
+	sem := make(chan struct{}, concurrency)
+	acquire := func() bool {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		return ctx.Err() == nil
+	}
+	for i := range pods {
+		pod := &pods[i]
+		// Without waiting for replacements slots are taken in order, so that pods are evicted in the planned order.
+		if r == nil && !acquire() {
+			notEvicted(pod)
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if r != nil {
+				r.waitForReplacement(ctx, pod)
+				if !acquire() {
+					notEvicted(pod)
+					return
+				}
+			}
+			defer func() { <-sem }()
+			if err := g.evictPodAndWait(ctx, pod); err != nil {
+				g.log.Errorf("evicting pod %s/%s: %v", pod.Namespace, pod.Name, err)
+				notEvicted(pod)
+			}
+		}()
+	}
+	wg.Wait()
+	sort.Strings(remaining)
+	return remaining
+}
+
+func (g *SpotHandler) evictPodAndWait(ctx context.Context, pod *v1.Pod) error {
+	if err := g.evictPod(ctx, pod); err != nil {
+		return err
+	}
+	return g.waitForPodDeleted(ctx, pod)
+}
+
+// evictPod evicts the pod using the eviction API, so that pod disruption budgets are respected. Evictions
+// rejected by disruption budgets are retried.
+func (g *SpotHandler) evictPod(ctx context.Context, pod *v1.Pod) error {
+	return g.retry(ctx, operationEvictPod, func() error {
+		err := g.evict(ctx, pod)
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		if apierrors.IsForbidden(err) {
+			return backoff.Permanent(err)
+		}
+		return err
+	})
+}
+
+func (g *SpotHandler) waitForPodDeleted(ctx context.Context, pod *v1.Pod) error {
+	return wait.PollUntilContextCancel(ctx, podDeletionPollInterval, true, func(ctx context.Context) (bool, error) {
+		p, err := g.clientset.CoreV1().Pods(pod.Namespace).Get(ctx, pod.Name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return true, nil
+		}
+		if err != nil {
+			// Transient errors are ignored until the budget is spent.
+			return false, nil
+		}
+		return p.UID != pod.UID, nil
+	})
+}
+
+// isEvictable excludes pods which are recreated on the node by their controllers or by kubelet.
+func isEvictable(pod *v1.Pod) bool {
+	if _, ok := pod.Annotations[v1.MirrorPodAnnotationKey]; ok {
+		return false
+	}
+	if owner := metav1.GetControllerOf(pod); owner != nil && owner.Kind == "DaemonSet" {
+		return false
+	}
+	return true
+}
+
+func isStateful(pod *v1.Pod) bool {
+	if owner := metav1.GetControllerOf(pod); owner != nil && owner.Kind == "StatefulSet" {
+		return true
+	}
+	for _, v := range pod.Spec.Volumes {
+		if v.PersistentVolumeClaim != nil || v.Ephemeral != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func podPriority(pod *v1.Pod) int32 {
+	return ptr.Deref(pod.Spec.Priority, 0)
+}
+
+func budgetWeight(grp DrainGroup) int {
+	if grp.BudgetWeight <= 0 {
+		return 1
+	}
+	return grp.BudgetWeight
+}
+
+func podNames(pods []v1.Pod) []string {
+	names := make([]string, 0, len(pods))
+	for _, p := range pods {
+		names = append(names, p.Namespace+"/"+p.Name)
+	}
+	return names
+}
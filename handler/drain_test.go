@@ -0,0 +1,218 @@
+package handler
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	ktest "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+)
+
+func newDrainPod(name string, priority int32, mutate ...func(*v1.Pod)) *v1.Pod {
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", UID: types.UID("uid-" + name)},
+		Spec:       v1.PodSpec{NodeName: "AI", Priority: ptr.To(priority)},
+		Status:     v1.PodStatus{Phase: v1.PodRunning},
+	}
+	for _, m := range mutate {
+		m(pod)
+	}
+	return pod
+}
+
+func ownedBy(kind string) func(*v1.Pod) {
+	return func(p *v1.Pod) {
+		p.OwnerReferences = []metav1.OwnerReference{{Kind: kind, Name: "owner", Controller: ptr.To(true)}}
+	}
+}
+
+func TestDrainPlan(t *testing.T) {
+	r := require.New(t)
+
+	pods := []v1.Pod{
+		*newDrainPod("critical", systemCriticalPriority),
+		*newDrainPod("stateful", 100, ownedBy("StatefulSet")),
+		*newDrainPod("stateless-high", 100),
+		*newDrainPod("stateless-low", 0, ownedBy("ReplicaSet")),
+		*newDrainPod("daemon", 0, ownedBy("DaemonSet")),
+		*newDrainPod("mirror", 0, func(p *v1.Pod) {
+			p.Annotations = map[string]string{v1.MirrorPodAnnotationKey: "mirror"}
+		}),
+	}
+
+	plan := drainPlan(pods, DefaultDrainGroups())
+	got := map[string][]string{}
+	var order []string
+	for _, step := range plan {
+		order = append(order, step.group.Name)
+		got[step.group.Name] = podNames(step.pods)
+	}
+	r.Equal([]string{DrainGroupStateless, DrainGroupStateful, DrainGroupCritical}, order)
+	r.Equal(map[string][]string{
+		DrainGroupStateless: {"default/stateless-low", "default/stateless-high"},
+		DrainGroupStateful:  {"default/stateful"},
+		DrainGroupCritical:  {"default/critical"},
+	}, got)
+
+	t.Run("unmatched pods are drained last", func(t *testing.T) {
+		r := require.New(t)
+		plan := drainPlan(pods, []DrainGroup{{Name: "low", MaxPriority: ptr.To[int32](0)}})
+		r.Len(plan, 2)
+		r.Equal("low", plan[0].group.Name)
+		r.Equal(drainGroupOther, plan[1].group.Name)
+		r.Len(plan[1].pods, 3)
+	})
+}
+
+func TestDrainNode(t *testing.T) {
+	log := logrus.New()
+	nodeName := "AI"
+	node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: nodeName}}
+
+	t.Run("evict pods group by group", func(t *testing.T) {
+		r := require.New(t)
+
+		fakeApi := fake.NewSimpleClientset(node,
+			newDrainPod("critical", systemCriticalPriority),
+			newDrainPod("stateful", 0, ownedBy("StatefulSet")),
+			newDrainPod("stateless", 0),
+			newDrainPod("daemon", 0, ownedBy("DaemonSet")),
+		)
+		var mu sync.Mutex
+		var evicted []string
+		fakeApi.PrependReactor("create", "pods", func(action ktest.Action) (bool, runtime.Object, error) {
+			if action.GetSubresource() != "eviction" {
+				return false, nil, nil
+			}
+			eviction := action.(ktest.CreateAction).GetObject().(*policyv1.Eviction)
+			mu.Lock()
+			evicted = append(evicted, eviction.Name)
+			mu.Unlock()
+			return true, nil, fakeApi.Tracker().Delete(v1.SchemeGroupVersion.WithResource("pods"), eviction.Namespace, eviction.Name)
+		})
+
+		handler := SpotHandler{
+			clientset:         fakeApi,
+			nodeName:          nodeName,
+			log:               log,
+			phase2Permissions: true,
+			drain:             DrainConfig{Enabled: true},
+		}
+		handler.drainNode(context.Background(), &InterruptNotice{Time: time.Now().Add(time.Minute)})
+
+		r.Equal([]string{"stateless", "stateful", "critical"}, evicted)
+		got, err := fakeApi.CoreV1().Nodes().Get(context.Background(), nodeName, metav1.GetOptions{})
+		r.NoError(err)
+		r.True(got.Spec.Unschedulable)
+		_, err = fakeApi.CoreV1().Pods("default").Get(context.Background(), "daemon", metav1.GetOptions{})
+		r.NoError(err)
+	})
+
+	t.Run("report pods not evicted within budget", func(t *testing.T) {
+		r := require.New(t)
+
+		fakeApi := fake.NewSimpleClientset(node, newDrainPod("blocked", 0))
+		fakeApi.PrependReactor("create", "pods", func(action ktest.Action) (bool, runtime.Object, error) {
+			if action.GetSubresource() != "eviction" {
+				return false, nil, nil
+			}
+			return true, nil, apierrors.NewTooManyRequests("disruption budget", 1)
+		})
+		recorder := record.NewFakeRecorder(10)
+
+		handler := SpotHandler{
+			clientset:         fakeApi,
+			nodeName:          nodeName,
+			log:               log,
+			phase2Permissions: true,
+			drain:             DrainConfig{Enabled: true},
+			retryConfig:       RetryConfig{InitialInterval: 10 * time.Millisecond},
+			recorder:          recorder,
+		}
+		start := time.Now()
+		handler.drainNode(context.Background(), &InterruptNotice{Time: time.Now().Add(time.Second)})
+
+		r.Less(time.Since(start), 3*time.Second)
+		r.Len(recorder.Events, 1)
+		r.Contains(<-recorder.Events, "default/blocked")
+		_, err := fakeApi.CoreV1().Pods("default").Get(context.Background(), "blocked", metav1.GetOptions{})
+		r.NoError(err)
+	})
+
+	t.Run("detach volumes after eviction budget is spent", func(t *testing.T) {
+		r := require.New(t)
+
+		volume := v1.UniqueVolumeName("kubernetes.io/csi/ebs.csi.aws.com^vol")
+		attachment, _ := volumeAttachmentName(volume, nodeName)
+		node := node.DeepCopy()
+		node.Status.VolumesAttached = []v1.AttachedVolume{{Name: volume}}
+		fakeApi := fake.NewSimpleClientset(node, newDrainPod("blocked", 0), &storagev1.VolumeAttachment{
+			ObjectMeta: metav1.ObjectMeta{Name: attachment},
+			Spec: storagev1.VolumeAttachmentSpec{
+				NodeName: nodeName,
+				Source:   storagev1.VolumeAttachmentSource{PersistentVolumeName: ptr.To("pv")},
+			},
+		})
+		var mu sync.Mutex
+		var lastEviction time.Time
+		fakeApi.PrependReactor("create", "pods", func(action ktest.Action) (bool, runtime.Object, error) {
+			if action.GetSubresource() != "eviction" {
+				return false, nil, nil
+			}
+			mu.Lock()
+			lastEviction = time.Now()
+			mu.Unlock()
+			return true, nil, apierrors.NewTooManyRequests("disruption budget", 1)
+		})
+
+		handler := SpotHandler{
+			clientset:         fakeApi,
+			nodeName:          nodeName,
+			log:               log,
+			phase2Permissions: true,
+			drain:             DrainConfig{Enabled: true, VolumeDetach: VolumeDetachAttachments},
+			retryConfig:       RetryConfig{InitialInterval: 10 * time.Millisecond, MaxInterval: 50 * time.Millisecond},
+		}
+		notice := &InterruptNotice{Time: time.Now().Add(2 * time.Second)}
+		handler.drainNode(context.Background(), notice)
+
+		// A quarter of the remaining time is reserved for volume detach.
+		r.Less(lastEviction, notice.Time.Add(-400*time.Millisecond))
+
+		list, err := fakeApi.StorageV1().VolumeAttachments().List(context.Background(), metav1.ListOptions{})
+		r.NoError(err)
+		r.Empty(list.Items)
+	})
+
+	t.Run("do not evict pods in dry-run mode", func(t *testing.T) {
+		r := require.New(t)
+
+		fakeApi := fake.NewSimpleClientset(node, newDrainPod("pod", 0))
+		handler := SpotHandler{
+			clientset:         fakeApi,
+			nodeName:          nodeName,
+			log:               log,
+			phase2Permissions: true,
+			dryRun:            true,
+			drain:             DrainConfig{Enabled: true},
+		}
+		handler.drainNode(context.Background(), &InterruptNotice{Time: time.Now().Add(time.Minute)})
+
+		for _, action := range fakeApi.Actions() {
+			r.NotEqual("eviction", action.GetSubresource())
+		}
+	})
+}
@@ -2,6 +2,10 @@ package handler
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
 
 	"cloud.google.com/go/compute/metadata"
 )
@@ -18,11 +22,34 @@ type metadataGetter interface {
 	Get(path string) (string, error)
 }
 
-// NewGCPChecker checks for gcp spot interrupt event from metadata server.
-func NewGCPChecker() MetadataChecker {
-	return &gcpInterruptChecker{
-		metadata: metadata.NewClient(nil),
+// NewGCPChecker checks for gcp spot interrupt event from metadata server. Requests are sent to metadataURL instead
+// of the default metadata server when it's not empty.
+func NewGCPChecker(metadataURL string) (MetadataChecker, error) {
+	var client *http.Client
+	if metadataURL != "" {
+		u, err := url.Parse(metadataURL)
+		if err != nil {
+			return nil, fmt.Errorf("parsing metadata url: %w", err)
+		}
+		client = &http.Client{Transport: &metadataHostTransport{target: u, base: http.DefaultTransport}}
 	}
+	return &gcpInterruptChecker{
+		metadata: metadata.NewClient(client),
+	}, nil
+}
+
+// metadataHostTransport redirects requests of the metadata client, which always targets the default metadata host.
+type metadataHostTransport struct {
+	target *url.URL
+	base   http.RoundTripper
+}
+
+func (t *metadataHostTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme = t.target.Scheme
+	req.URL.Host = t.target.Host
+	req.Host = t.target.Host
+	return t.base.RoundTrip(req)
 }
 
 type gcpInterruptChecker struct {
@@ -30,16 +57,35 @@ type gcpInterruptChecker struct {
 }
 
 func (c *gcpInterruptChecker) CheckInterrupt(ctx context.Context) (bool, error) {
+	notice, err := c.GetInterruptNotice(ctx)
+	return notice != nil, err
+}
+
+func (c *gcpInterruptChecker) GetInterruptNotice(_ context.Context) (*InterruptNotice, error) {
 	m, err := c.metadata.Get(maintenanceSuffix)
 	if err != nil {
-		return false, err
+		return nil, err
 	}
 	p, err := c.metadata.Get(preemptionSuffix)
 	if err != nil {
-		return false, err
+		return nil, err
 	}
 
-	return m == maintenanceEventTerminate || p == preemptionEventTrue, nil
+	// GCP doesn't report the interruption time, preempted instances are stopped within 30 seconds.
+	var notice *InterruptNotice
+	switch {
+	case p == preemptionEventTrue:
+		notice = &InterruptNotice{Action: "preempted", Status: NoticeStatusStarted}
+	case m == maintenanceEventTerminate:
+		notice = &InterruptNotice{Action: m, Status: NoticeStatusScheduled}
+	default:
+		return nil, nil
+	}
+	notice.Raw, _ = json.Marshal(map[string]string{
+		maintenanceSuffix: m,
+		preemptionSuffix:  p,
+	})
+	return notice, nil
 }
 
 func (c *gcpInterruptChecker) CheckRebalanceRecommendation(ctx context.Context) (bool, error) {
@@ -2,9 +2,12 @@ package handler
 
 import (
 	"context"
+	"net/http/httptest"
 	"testing"
 
 	"github.com/stretchr/testify/require"
+
+	"github.com/castai/spot-handler/metadatafake"
 )
 
 func TestGCPInterruptChecker(t *testing.T) {
@@ -27,3 +30,22 @@ func (md mockMetadata) Get(path string) (string, error) {
 	}
 	return m[path], nil
 }
+
+func TestGCPInterruptCheckerWithMetadataServer(t *testing.T) {
+	metadata := metadatafake.New()
+	s := httptest.NewServer(metadata)
+	defer s.Close()
+
+	checker, err := NewGCPChecker(s.URL)
+	require.NoError(t, err)
+
+	interrupted, err := checker.CheckInterrupt(context.Background())
+	require.NoError(t, err)
+	require.False(t, interrupted)
+
+	require.NoError(t, metadata.Apply(metadatafake.Step{Type: metadatafake.TypeInterrupted}))
+
+	interrupted, err = checker.CheckInterrupt(context.Background())
+	require.NoError(t, err)
+	require.True(t, interrupted)
+}
@@ -3,20 +3,28 @@ package handler
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"slices"
 	"sync"
 	"time"
 
 	"github.com/cenkalti/backoff/v4"
 	"github.com/sirupsen/logrus"
 	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	apitypes "k8s.io/apimachinery/pkg/types"
-	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"k8s.io/apimachinery/pkg/types"
+	corev1ac "k8s.io/client-go/applyconfigurations/core/v1"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/utils/ptr"
 
 	"github.com/castai/spot-handler/castai"
+	"github.com/castai/spot-handler/hooks"
+	"github.com/castai/spot-handler/metrics"
+	"github.com/castai/spot-handler/notifier"
+	"github.com/castai/spot-handler/version"
 )
 
 const (
@@ -32,9 +40,23 @@ const (
 	valueNodeDrainingReasonInterrupted = "spot-interruption"
 
 	cloudEventInterrupted             = "interrupted"
-	cloudEventRebalanceRecommendation = "rebalanceRecommendation"
+	cloudEventInterruptionStarted     = "interruptionStarted"
+	cloudEventInterruptionTimeChanged = "interruptionTimeChanged"
+	cloudEventInterruptionCompleted   = "interruptionCompleted"
+	cloudEventRebalanceRecommendation = castai.EventTypeRebalanceRecommendation
 
 	valueTrue = "true"
+
+	defaultPollTimeout = 10 * time.Second
+
+	// fieldManager owns node fields changed by the handler when using server-side apply.
+	fieldManager = "castai-spot-handler"
+)
+
+const (
+	NoticeStatusScheduled = "Scheduled"
+	NoticeStatusStarted   = "Started"
+	NoticeStatusCompleted = "Completed"
 )
 
 type MetadataChecker interface {
@@ -42,15 +64,96 @@ type MetadataChecker interface {
 	CheckRebalanceRecommendation(ctx context.Context) (bool, error)
 }
 
+// NoticeChecker is implemented by metadata checkers which are able to report details of the interruption notice.
+// Checkers not implementing it are tracked only by the presence of the notice.
+type NoticeChecker interface {
+	// GetInterruptNotice returns nil if there is no interruption notice.
+	GetInterruptNotice(ctx context.Context) (*InterruptNotice, error)
+}
+
+// InterruptNotice describes an interruption notice reported by the cloud metadata service.
+type InterruptNotice struct {
+	// Action is the provider specific action, e.g. "terminate" on AWS or "Preempt" on Azure.
+	Action string
+	// Status is one of NoticeStatus* values.
+	Status string
+	// Time when the instance is going to be interrupted. Zero if not reported by the provider.
+	Time time.Time
+	// Raw is the notice as returned by the provider metadata service, nil if not available.
+	Raw json.RawMessage
+	// DetectedAt is when the handler first saw the notice.
+	DetectedAt time.Time
+	// DetectionLatency is the time since the last poll which didn't see the notice, zero if the notice was present
+	// since start.
+	DetectionLatency time.Duration
+	// Simulated is set for synthetic notices, see NoticeInjector.
+	Simulated bool
+}
+
 type SpotHandler struct {
+	// mu guards settings changed by Reconfigure.
+	mu sync.RWMutex
+	// reconfigured is signalled by Reconfigure, nil until the handler is running.
+	reconfigured chan struct{}
+	// castClient is nil in standalone mode.
 	castClient        castai.Client
+	notifiers         []notifier.Notifier
 	clientset         kubernetes.Interface
+	nodeCache         *nodeCache
 	metadataChecker   MetadataChecker
 	nodeName          string
 	pollWaitInterval  time.Duration
 	log               logrus.FieldLogger
+	pollTimeout       time.Duration
 	gracePeriod       time.Duration
 	phase2Permissions bool
+	retryConfig       RetryConfig
+	// dryRun disables mothership calls and node changes, actions which would be taken are logged instead.
+	dryRun bool
+	// podAnnotations enables annotating pods on the node with interruption details.
+	podAnnotations bool
+	// drain configures eviction of pods on interruption.
+	drain DrainConfig
+	// outOfServiceTaint enables tainting the node out-of-service once it's shut down after the interruption.
+	outOfServiceTaint bool
+	// k8sVersion gates features not supported by all clusters, nil if unknown.
+	k8sVersion version.Interface
+	// hooks are run on interruption notice, nil if not configured.
+	hooks *hooks.Runner
+	// recorder reports handler actions as node events, nil disables events.
+	recorder record.EventRecorder
+	// handlerVersion and provider are reported in cloud events and heartbeats.
+	handlerVersion string
+	provider       string
+	// heartbeatInterval is how often the mothership is told the handler is healthy, zero disables heartbeats.
+	heartbeatInterval time.Duration
+	stats             handlerStats
+}
+
+// Options configures the SpotHandler, zero values disable optional features.
+type Options struct {
+	PollInterval      time.Duration
+	PollTimeout       time.Duration
+	GracePeriod       time.Duration
+	Phase2Permissions bool
+	Retry             RetryConfig
+	// DryRun disables mothership calls and node changes, actions which would be taken are logged instead.
+	DryRun    bool
+	Notifiers []notifier.Notifier
+	// AnnotatePods enables annotating pods on the node with interruption details.
+	AnnotatePods bool
+	Drain        DrainConfig
+	// OutOfServiceTaint enables tainting the node out-of-service once it's shut down after the interruption.
+	OutOfServiceTaint bool
+	// KubernetesVersion gates features not supported by all clusters, nil if unknown.
+	KubernetesVersion version.Interface
+	Hooks             *hooks.Runner
+	// Recorder reports handler actions as node events, nil disables events.
+	Recorder record.EventRecorder
+	// Version and Provider are reported in cloud events and heartbeats.
+	Version           string
+	Provider          string
+	HeartbeatInterval time.Duration
 }
 
 func NewSpotHandler(
@@ -58,101 +161,304 @@ func NewSpotHandler(
 	castClient castai.Client,
 	clientset kubernetes.Interface,
 	metadataChecker MetadataChecker,
-	pollWaitInterval time.Duration,
 	nodeName string,
-	phase2Permissions bool,
+	opts Options,
 ) *SpotHandler {
 	return &SpotHandler{
 		castClient:        castClient,
 		clientset:         clientset,
+		nodeCache:         newNodeCache(clientset, nodeName),
 		metadataChecker:   metadataChecker,
 		log:               log,
 		nodeName:          nodeName,
-		pollWaitInterval:  pollWaitInterval,
-		gracePeriod:       30 * time.Second,
-		phase2Permissions: phase2Permissions,
+		pollWaitInterval:  opts.PollInterval,
+		pollTimeout:       opts.PollTimeout,
+		gracePeriod:       opts.GracePeriod,
+		phase2Permissions: opts.Phase2Permissions,
+		retryConfig:       opts.Retry,
+		dryRun:            opts.DryRun,
+		notifiers:         opts.Notifiers,
+		podAnnotations:    opts.AnnotatePods,
+		drain:             opts.Drain,
+		outOfServiceTaint: opts.OutOfServiceTaint,
+		k8sVersion:        opts.KubernetesVersion,
+		hooks:             opts.Hooks,
+		recorder:          opts.Recorder,
+		handlerVersion:    opts.Version,
+		provider:          opts.Provider,
+		heartbeatInterval: opts.HeartbeatInterval,
 	}
 }
 
+// Run polls the metadata service until ctx is done and the shutdown grace period passes. Values of ctx are
+// kept during the grace period, so that notices received while the node is shutting down are still handled.
 func (g *SpotHandler) Run(ctx context.Context) error {
-	t := time.NewTicker(g.pollWaitInterval)
+	reconfigured := g.watchReconfigure()
+	interval := g.pollInterval()
+	t := time.NewTicker(interval)
 	defer t.Stop()
 
-	var once sync.Once
+	if g.nodeCache != nil {
+		stopCh := make(chan struct{})
+		defer close(stopCh)
+		go g.nodeCache.run(g.log, stopCh)
+	}
+
+	if g.castClient != nil && g.heartbeatInterval > 0 {
+		stopHeartbeat := make(chan struct{})
+		defer close(stopHeartbeat)
+		go g.runHeartbeat(ctx, stopHeartbeat)
+	}
+
 	deadline := time.NewTimer(24 * 365 * time.Hour)
+	defer deadline.Stop()
 
-	// Once rebalance recommendation is set by cloud it stays there permanently. It needs to be sent only once.
-	var rebalanceRecommendationSent bool
+	loopCtx := ctx
+	done := ctx.Done()
+	var state pollState
+	defer state.localActions.Wait()
 
 	for {
 		select {
 		case <-t.C:
-			err := func() error {
-				ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-				defer cancel()
-
-				interrupted, err := g.metadataChecker.CheckInterrupt(ctx)
-				if err != nil {
-					return err
-				}
-				if interrupted {
-					g.log.Infof("preemption notice received")
-					if err := g.handleInterruption(ctx); err != nil {
-						return err
-					}
-					// Stop after ACK.
-					t.Stop()
-				}
-
-				if !rebalanceRecommendationSent {
-					rebalanceRecommendation, err := g.metadataChecker.CheckRebalanceRecommendation(ctx)
-					if err != nil {
-						return err
-					}
-					if rebalanceRecommendation {
-						g.log.Infof("rebalance recommendation notice received")
-						if err := g.handleRebalanceRecommendation(ctx); err != nil {
-							return err
-						}
-						rebalanceRecommendationSent = true
-					}
-				}
-
-				return nil
-			}()
-
-			if err != nil {
+			if err := g.poll(loopCtx, &state); err != nil {
 				g.log.Errorf("checking for cloud events: %v", err)
 			}
+		case <-reconfigured:
+			if i := g.pollInterval(); i != interval {
+				interval = i
+				t.Reset(interval)
+			}
 		case <-deadline.C:
 			return nil
-		case <-ctx.Done():
+		case <-done:
 			// Signal received, starting countdown until exiting the loop.
-			once.Do(func() {
-				deadline.Reset(g.gracePeriod)
-			})
+			deadline.Reset(g.gracePeriod)
+			var cancel context.CancelFunc
+			loopCtx, cancel = context.WithTimeout(context.WithoutCancel(ctx), g.gracePeriod)
+			defer cancel()
+			done = nil
 		}
 	}
 }
 
-func (g *SpotHandler) handleInterruption(ctx context.Context) error {
-	node, err := g.clientset.CoreV1().Nodes().Get(ctx, g.nodeName, metav1.GetOptions{})
+// pollState is kept between poll loop ticks.
+type pollState struct {
+	// Once rebalance recommendation is set by cloud it stays there permanently. It needs to be sent only once.
+	rebalanceRecommendationSent bool
+	// Last seen state of the acknowledged interruption notice, nil until interruption is handled.
+	interruption *InterruptNotice
+	// interruptionCompleted is set once the interruption is reported completed. Spot instances don't survive it,
+	// notices seen afterwards are the same interruption flapping and are ignored.
+	interruptionCompleted bool
+	// localActionsStarted is set once pod notification, pre-termination hooks and drain are started, they run only
+	// once per interruption.
+	localActionsStarted bool
+	localActions        sync.WaitGroup
+	podAnnotations      podAnnotationState
+	// outOfServiceApplied is set once the node is tainted out-of-service, and cleared once the taint is removed from a
+	// node which survived the interruption.
+	outOfServiceApplied bool
+	// lastClearPoll is the start of the last poll which didn't see an interruption notice.
+	lastClearPoll time.Time
+	// notified keeps notifiers from receiving events again when they're resent because the mothership failed.
+	notified notifierDeliveries
+}
+
+// resetInterruption forgets the handled interruption, so that the next notice is handled as a new one.
+func (s *pollState) resetInterruption() {
+	s.interruption = nil
+	s.interruptionCompleted = false
+	s.localActionsStarted = false
+}
+
+func (g *SpotHandler) poll(ctx context.Context, state *pollState) error {
+	pollTimeout := g.pollTimeout
+	if pollTimeout <= 0 {
+		pollTimeout = defaultPollTimeout
+	}
+	pollCtx, cancel := context.WithTimeout(ctx, pollTimeout)
+	defer cancel()
+	// Retries of notifications and node updates are bounded by the poll interval so that they don't block polling,
+	// failed ones are retried on the next polls. Mothership events are given up once the retry budget since their
+	// first attempt is spent, see retryDeadline.
+	retryCtx := ctx
+	if interval := g.pollInterval(); interval > 0 {
+		var cancelRetry context.CancelFunc
+		retryCtx, cancelRetry = context.WithTimeout(ctx, interval)
+		defer cancelRetry()
+	}
+
+	pollStarted := time.Now()
+	notice, err := g.checkInterruptNotice(pollCtx)
+	g.stats.polled(err)
 	if err != nil {
 		return err
 	}
+	if notice == nil {
+		state.lastClearPoll = pollStarted
+	}
+	if state.interruption == nil {
+		// Notice reported completed from the start belongs to an interruption which is already over.
+		if notice != nil && notice.Status != NoticeStatusCompleted && !state.interruptionCompleted {
+			notice.DetectedAt = time.Now()
+			if !state.lastClearPoll.IsZero() {
+				notice.DetectionLatency = notice.DetectedAt.Sub(state.lastClearPoll)
+			}
+			g.log.Infof("preemption notice received")
+			metrics.NoticeReceived(cloudEventInterrupted)
+			if !state.localActionsStarted {
+				// Local actions don't wait for the mothership, they have to finish before the node goes away.
+				state.localActionsStarted = true
+				g.annotatePodsAsync(ctx, state, notice)
+				state.localActions.Add(2)
+				go func() {
+					defer state.localActions.Done()
+					g.runHooks(ctx, notice)
+				}()
+				go func() {
+					defer state.localActions.Done()
+					g.drainNode(ctx, notice)
+				}()
+			}
+			if err := g.handleInterruption(retryCtx, notice, &state.notified); err != nil {
+				return err
+			}
+			// Keep polling after ACK to report follow-up changes of the notice.
+			state.interruption = notice
+		}
+	} else {
+		prev := state.interruption
+		tracked := notice
+		if prev.Simulated && (notice == nil || !notice.Simulated) {
+			// Injected notice was cleared, it's reported completed even if a real notice is present.
+			tracked = nil
+		}
+		state.interruption, err = g.trackInterruption(retryCtx, prev, tracked, &state.notified)
+		switch {
+		case err != nil:
+		case prev.Simulated && (state.interruption == nil || state.interruption.Status == NoticeStatusCompleted):
+			// Simulated interruption never happened, real notices are handled as if it wasn't there.
+			state.resetInterruption()
+		case state.interruption == nil:
+			state.interruptionCompleted = true
+		}
+		if state.interruption != nil && !state.interruption.Time.Equal(prev.Time) {
+			g.annotatePodsAsync(ctx, state, state.interruption)
+		}
+		if err != nil {
+			return err
+		}
+	}
 
-	req := &castai.CloudEventRequest{
-		EventType: cloudEventInterrupted,
-		NodeID:    node.Labels[CastNodeIDLabel],
+	interrupted := state.interruption != nil && state.interruption.Status != NoticeStatusCompleted
+	if interrupted && !state.outOfServiceApplied && g.outOfServiceDue(state.interruption) {
+		applied, err := g.handleOutOfService(retryCtx, state.interruption)
+		if err != nil {
+			return err
+		}
+		state.outOfServiceApplied = applied
 	}
-	if node.Spec.ProviderID != "" {
-		req.ProviderID = &node.Spec.ProviderID
+	if !interrupted && state.outOfServiceApplied {
+		if err := g.removeOutOfService(retryCtx); err != nil {
+			return err
+		}
+		state.outOfServiceApplied = false
 	}
-	if node.Annotations != nil && node.Annotations[OverrideProviderIDAnnot] != "" {
-		req.ProviderID = ptr.To(node.Annotations[OverrideProviderIDAnnot])
+
+	if !state.rebalanceRecommendationSent {
+		rebalanceRecommendation, err := g.metadataChecker.CheckRebalanceRecommendation(pollCtx)
+		if err != nil {
+			return err
+		}
+		if rebalanceRecommendation {
+			g.log.Infof("rebalance recommendation notice received")
+			metrics.NoticeReceived(cloudEventRebalanceRecommendation)
+			if err := g.handleRebalanceRecommendation(retryCtx, &state.notified); err != nil {
+				return err
+			}
+			state.rebalanceRecommendationSent = true
+		}
+	}
+
+	return nil
+}
+
+func (g *SpotHandler) checkInterruptNotice(ctx context.Context) (*InterruptNotice, error) {
+	return getInterruptNotice(ctx, g.metadataChecker)
+}
+
+// getInterruptNotice returns notice details if the checker is able to report them, otherwise only presence of the
+// notice is reported.
+func getInterruptNotice(ctx context.Context, checker MetadataChecker) (*InterruptNotice, error) {
+	if c, ok := checker.(NoticeChecker); ok {
+		return c.GetInterruptNotice(ctx)
+	}
+
+	interrupted, err := checker.CheckInterrupt(ctx)
+	if err != nil || !interrupted {
+		return nil, err
 	}
+	return &InterruptNotice{Status: NoticeStatusScheduled}, nil
+}
+
+// trackInterruption compares the current interruption notice with the previously seen one and sends follow-up
+// cloud events on changes. Returned notice becomes the previous one for the next check. Previous notice is
+// returned on failure so that the change is reported again on the next tick.
+func (g *SpotHandler) trackInterruption(ctx context.Context, prev, notice *InterruptNotice, notified *notifierDeliveries) (*InterruptNotice, error) {
+	ctx, cancel := g.retryContext(ctx, prev)
+	defer cancel()
+
+	if prev.Status == NoticeStatusCompleted {
+		// Final outcome was already reported, wait for the notice to go away.
+		return notice, nil
+	}
+
+	if notice == nil || notice.Status == NoticeStatusCompleted {
+		g.log.Infof("interruption notice completed")
+		if err := g.sendCloudEvent(ctx, cloudEventInterruptionCompleted, prev, notified); err != nil {
+			return prev, err
+		}
+		return notice, nil
+	}
+
+	next := *notice
+	next.DetectedAt, next.DetectionLatency = prev.DetectedAt, prev.DetectionLatency
+	if next.Time.IsZero() {
+		// Provider may stop reporting time once the interruption started, keep the last known one.
+		next.Time = prev.Time
+	}
+
+	if next.Status == NoticeStatusStarted && prev.Status != NoticeStatusStarted {
+		g.log.Infof("interruption notice started")
+		if err := g.sendCloudEvent(ctx, cloudEventInterruptionStarted, &next, notified); err != nil {
+			return prev, err
+		}
+	}
+
+	if !next.Time.Equal(prev.Time) {
+		g.log.Infof("interruption notice time changed from %s to %s", prev.Time, next.Time)
+		if err := g.sendCloudEvent(ctx, cloudEventInterruptionTimeChanged, &next, notified); err != nil {
+			next.Time = prev.Time
+			return &next, err
+		}
+	}
+
+	return &next, nil
+}
+
+func (g *SpotHandler) handleInterruption(ctx context.Context, notice *InterruptNotice, notified *notifierDeliveries) error {
+	ctx, cancel := g.retryContext(ctx, notice)
+	defer cancel()
+
+	node, err := g.getNode(ctx)
+	if err != nil {
+		return err
+	}
+
+	req := g.newCloudEventRequest(node, cloudEventInterrupted, notice)
 	g.log.Infof("sending interruption cloud event to mothership: nodeID: %s, providerID: %s", req.NodeID, ptr.Deref(req.ProviderID, ""))
-	if err = g.castClient.SendCloudEvent(ctx, req); err != nil {
+	if err = g.notify(ctx, node, req, notice, notified); err != nil {
 		return err
 	}
 
@@ -164,71 +470,176 @@ func (g *SpotHandler) handleInterruption(ctx context.Context) error {
 	return nil
 }
 
-func (g *SpotHandler) taintNode(ctx context.Context, node *v1.Node) error {
-	if node.Spec.Unschedulable {
+func (g *SpotHandler) sendCloudEvent(ctx context.Context, eventType string, notice *InterruptNotice, notified *notifierDeliveries) error {
+	node, err := g.getNode(ctx)
+	if err != nil {
+		return err
+	}
+
+	req := g.newCloudEventRequest(node, eventType, notice)
+	g.log.Infof("sending %s cloud event to mothership: nodeID: %s, providerID: %s", eventType, req.NodeID, ptr.Deref(req.ProviderID, ""))
+	return g.notify(ctx, node, req, notice, notified)
+}
+
+// notify sends the cloud event to the mothership and the event to other notifiers at the same time. Only the
+// mothership failure is returned, so that the event is sent again on the next poll. Notifiers retry on their own
+// and their failures are logged. Notifiers which already received the event according to notified are skipped.
+func (g *SpotHandler) notify(ctx context.Context, node *v1.Node, req *castai.CloudEventRequest, notice *InterruptNotice, notified *notifierDeliveries) error {
+	notifiers := g.currentNotifiers()
+	if g.isDryRun() {
+		g.log.Infof("dry-run: would send %s cloud event to mothership and %d notifiers", req.EventType, len(notifiers))
+		metrics.DryRunAction(operationSendCloudEvent)
 		return nil
 	}
 
-	err := g.patchNode(ctx, node, func(n *v1.Node) error {
-		n.Spec.Unschedulable = true
-		n.Labels[labelNodeDraining] = valueNodeDrainingReasonInterrupted
-		n.Spec.Taints = append(n.Spec.Taints, v1.Taint{
-			Key:    taintNodeDraining,
-			Value:  valueTrue,
-			Effect: taintNodeDrainingEffect,
-		})
+	event := newNotifierEvent(node, req, notice)
+	var wg sync.WaitGroup
+	for _, n := range notifiers {
+		if notified.delivered(n, event) {
+			continue
+		}
+		wg.Add(1)
+		go func(n notifier.Notifier) {
+			defer wg.Done()
+			if err := n.Notify(ctx, event); err != nil {
+				metrics.OperationFailed(operationNotify + n.Name())
+				g.log.Errorf("notifying %s about %s event: %v", n.Name(), event.Type, err)
+				return
+			}
+			notified.markDelivered(n, event)
+		}(n)
+	}
+
+	defer wg.Wait()
+
+	if g.castClient == nil {
+		// Running in standalone mode without the mothership.
 		return nil
+	}
+	started := notified.attempted(event)
+	err := g.retry(ctx, operationSendCloudEvent, func() error {
+		err := g.castClient.SendCloudEvent(ctx, req)
+		var reqErr *castai.RequestError
+		if errors.As(err, &reqErr) && !reqErr.Retryable() {
+			return backoff.Permanent(err)
+		}
+		return err
 	})
 	if err != nil {
-		return fmt.Errorf("patching node unschedulable: %w", err)
+		g.stats.mothershipFailed()
+		if !started.IsZero() && !time.Now().Before(g.retryDeadline(started, notice)) {
+			// Event is resent on the following polls until the retry budget is spent.
+			g.log.Errorf("giving up sending %s cloud event to mothership, retried since %s: %v", req.EventType, started.Format(time.RFC3339), err)
+			return nil
+		}
 	}
-	return nil
+	return err
 }
 
-func (g *SpotHandler) patchNode(ctx context.Context, node *v1.Node, changeFn func(*v1.Node) error) error {
-	oldData, err := json.Marshal(node)
-	if err != nil {
-		return fmt.Errorf("marshaling old data: %w", err)
-	}
+// notifierDeliveries records events delivered to notifiers and when sending them to the mothership was first
+// attempted. Events are identified by their type and notice time, as Timestamp differs between attempts. Nil
+// notifierDeliveries records nothing.
+type notifierDeliveries struct {
+	mu       sync.Mutex
+	sent     map[string]struct{}
+	attempts map[string]time.Time
+}
 
-	if err := changeFn(node); err != nil {
-		return err
-	}
+func notifierDeliveryKey(n notifier.Notifier, event notifier.Event) string {
+	return n.Name() + "/" + eventKey(event)
+}
 
-	newData, err := json.Marshal(node)
-	if err != nil {
-		return fmt.Errorf("marshaling new data: %w", err)
+func eventKey(event notifier.Event) string {
+	key := event.Type
+	if event.NoticeTime != nil {
+		key += "/" + event.NoticeTime.Format(time.RFC3339Nano)
 	}
+	return key
+}
 
-	patch, err := strategicpatch.CreateTwoWayMergePatch(oldData, newData, node)
-	if err != nil {
-		return fmt.Errorf("creating patch for node: %w", err)
+// attempted returns when sending the event to the mothership was first attempted, zero if nothing is recorded.
+func (d *notifierDeliveries) attempted(event notifier.Event) time.Time {
+	if d == nil {
+		return time.Time{}
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.attempts == nil {
+		d.attempts = map[string]time.Time{}
+	}
+	key := eventKey(event)
+	if _, ok := d.attempts[key]; !ok {
+		d.attempts[key] = time.Now()
 	}
+	return d.attempts[key]
+}
 
-	err = backoff.Retry(func() error {
-		_, err = g.clientset.CoreV1().Nodes().Patch(ctx, node.Name, apitypes.StrategicMergePatchType, patch, metav1.PatchOptions{})
-		return err
-	}, defaultBackoff(ctx))
-	if err != nil {
-		return fmt.Errorf("patching node: %w", err)
+func (d *notifierDeliveries) delivered(n notifier.Notifier, event notifier.Event) bool {
+	if d == nil {
+		return false
 	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	_, ok := d.sent[notifierDeliveryKey(n, event)]
+	return ok
+}
 
-	return nil
+func (d *notifierDeliveries) markDelivered(n notifier.Notifier, event notifier.Event) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.sent == nil {
+		d.sent = map[string]struct{}{}
+	}
+	d.sent[notifierDeliveryKey(n, event)] = struct{}{}
 }
 
-func defaultBackoff(ctx context.Context) backoff.BackOffContext {
-	return backoff.WithContext(backoff.WithMaxRetries(backoff.NewConstantBackOff(1*time.Second), 5), ctx)
+func newNotifierEvent(node *v1.Node, req *castai.CloudEventRequest, notice *InterruptNotice) notifier.Event {
+	event := notifier.Event{
+		Type:       req.EventType,
+		NodeName:   node.Name,
+		NodeID:     req.NodeID,
+		ProviderID: ptr.Deref(req.ProviderID, ""),
+		Timestamp:  time.Now().UTC(),
+	}
+	if notice != nil && !notice.Time.IsZero() {
+		event.NoticeTime = ptr.To(notice.Time)
+	}
+	return event
 }
 
-func (g *SpotHandler) handleRebalanceRecommendation(ctx context.Context) error {
-	node, err := g.clientset.CoreV1().Nodes().Get(ctx, g.nodeName, metav1.GetOptions{})
-	if err != nil {
+func (g *SpotHandler) getNode(ctx context.Context) (*v1.Node, error) {
+	if g.nodeCache != nil {
+		if node, ok := g.nodeCache.get(g.nodeName); ok {
+			return node, nil
+		}
+	}
+
+	var node *v1.Node
+	err := g.retry(ctx, operationGetNode, func() error {
+		var err error
+		node, err = g.clientset.CoreV1().Nodes().Get(ctx, g.nodeName, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return backoff.Permanent(err)
+		}
 		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("getting node: %w", err)
 	}
+	return node, nil
+}
 
+func (g *SpotHandler) newCloudEventRequest(node *v1.Node, eventType string, notice *InterruptNotice) *castai.CloudEventRequest {
 	req := &castai.CloudEventRequest{
-		EventType: cloudEventRebalanceRecommendation,
-		NodeID:    node.Labels[CastNodeIDLabel],
+		EventType:     eventType,
+		NodeID:        node.Labels[CastNodeIDLabel],
+		SchemaVersion: castai.CloudEventSchemaVersion,
+		Node:          cloudEventNode(node),
+		Handler:       g.cloudEventHandler(),
+		Notice:        cloudEventNotice(notice),
 	}
 	if node.Spec.ProviderID != "" {
 		req.ProviderID = &node.Spec.ProviderID
@@ -236,7 +647,135 @@ func (g *SpotHandler) handleRebalanceRecommendation(ctx context.Context) error {
 	if node.Annotations != nil && node.Annotations[OverrideProviderIDAnnot] != "" {
 		req.ProviderID = ptr.To(node.Annotations[OverrideProviderIDAnnot])
 	}
+	return req
+}
+
+func (g *SpotHandler) taintNode(ctx context.Context, node *v1.Node) error {
+	if g.isDryRun() {
+		g.log.Infof("dry-run: would cordon node %s, set label %s=%s and taint %s=%s:%s",
+			node.Name, labelNodeDraining, valueNodeDrainingReasonInterrupted, taintNodeDraining, valueTrue, taintNodeDrainingEffect)
+		metrics.DryRunAction(operationApplyNode)
+		return nil
+	}
+
+	if err := g.addTaints(ctx, node, drainingTaint()); err != nil {
+		return err
+	}
+	return g.applyNode(ctx, drainingNode(node.Name))
+}
+
+// drainingNode returns node fields owned by the handler. Taints are not among them, as the taints list is shared
+// with other owners, see addTaints.
+func drainingNode(name string) *corev1ac.NodeApplyConfiguration {
+	return corev1ac.Node(name).
+		WithLabels(map[string]string{labelNodeDraining: valueNodeDrainingReasonInterrupted}).
+		WithSpec(corev1ac.NodeSpec().
+			WithUnschedulable(true),
+		)
+}
+
+func filterTaints(taints, remove []v1.Taint) []v1.Taint {
+	res := make([]v1.Taint, 0, len(taints))
+	for _, t := range taints {
+		if !slices.ContainsFunc(remove, func(r v1.Taint) bool { return r.Key == t.Key }) {
+			res = append(res, t)
+		}
+	}
+	return res
+}
+
+func hasTaint(taints []v1.Taint, taint v1.Taint) bool {
+	return slices.ContainsFunc(taints, func(t v1.Taint) bool {
+		return t.Key == taint.Key && t.Value == taint.Value && t.Effect == taint.Effect
+	})
+}
+
+func drainingTaint() v1.Taint {
+	return v1.Taint{Key: taintNodeDraining, Value: valueTrue, Effect: taintNodeDrainingEffect}
+}
+
+// addTaints adds taints to the node, replacing existing ones with the same keys.
+func (g *SpotHandler) addTaints(ctx context.Context, node *v1.Node, add ...v1.Taint) error {
+	err := g.patchTaints(ctx, node, func(taints []v1.Taint) ([]v1.Taint, bool) {
+		if !slices.ContainsFunc(add, func(t v1.Taint) bool { return !hasTaint(taints, t) }) {
+			return nil, false
+		}
+		return append(filterTaints(taints, add), add...), true
+	})
+	if err != nil {
+		return fmt.Errorf("tainting node: %w", err)
+	}
+	return nil
+}
+
+// removeTaints removes taints with the same keys from the node.
+func (g *SpotHandler) removeTaints(ctx context.Context, node *v1.Node, remove ...v1.Taint) error {
+	err := g.patchTaints(ctx, node, func(taints []v1.Taint) ([]v1.Taint, bool) {
+		left := filterTaints(taints, remove)
+		return left, len(left) != len(taints)
+	})
+	if err != nil {
+		return fmt.Errorf("removing node taints: %w", err)
+	}
+	return nil
+}
+
+// patchTaints replaces node taints with the ones returned by update, unless it reports no change. Taints are an
+// atomic list, applying it would take over taints of other owners, so the whole list is patched instead. Node
+// resource version is sent along so that taints changed since the node was read are not lost, on conflict the node
+// is read again.
+func (g *SpotHandler) patchTaints(ctx context.Context, node *v1.Node, update func([]v1.Taint) ([]v1.Taint, bool)) error {
+	return g.retry(ctx, operationApplyNode, func() error {
+		taints, changed := update(node.Spec.Taints)
+		if !changed {
+			return nil
+		}
+		data, err := json.Marshal(map[string]any{
+			"metadata": map[string]any{"resourceVersion": node.ResourceVersion},
+			"spec":     map[string]any{"taints": taints},
+		})
+		if err != nil {
+			return backoff.Permanent(fmt.Errorf("marshaling patch: %w", err))
+		}
+		_, err = g.clientset.CoreV1().Nodes().Patch(ctx, node.Name, types.StrategicMergePatchType, data, metav1.PatchOptions{FieldManager: fieldManager})
+		if apierrors.IsConflict(err) {
+			n, getErr := g.clientset.CoreV1().Nodes().Get(ctx, node.Name, metav1.GetOptions{})
+			if getErr != nil {
+				return getErr
+			}
+			node = n
+		}
+		return err
+	})
+}
+
+// applyNode applies the node fields owned by the handler using server-side apply.
+func (g *SpotHandler) applyNode(ctx context.Context, cfg *corev1ac.NodeApplyConfiguration) error {
+	err := g.retry(ctx, operationApplyNode, func() error {
+		return g.applyOrPatch(cfg, func() error {
+			_, err := g.clientset.CoreV1().Nodes().Apply(ctx, cfg, metav1.ApplyOptions{FieldManager: fieldManager, Force: true})
+			return err
+		}, func(data []byte) error {
+			_, err := g.clientset.CoreV1().Nodes().Patch(ctx, *cfg.Name, types.StrategicMergePatchType, data, metav1.PatchOptions{FieldManager: fieldManager})
+			return err
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("applying node: %w", err)
+	}
+	return nil
+}
+
+func (g *SpotHandler) handleRebalanceRecommendation(ctx context.Context, notified *notifierDeliveries) error {
+	ctx, cancel := g.retryContext(ctx, nil)
+	defer cancel()
+
+	node, err := g.getNode(ctx)
+	if err != nil {
+		return err
+	}
 
+	req := g.newCloudEventRequest(node, cloudEventRebalanceRecommendation, nil)
 	g.log.Infof("sending rebalance recommendation cloud event to mothership: nodeID: %s, providerID: %s", req.NodeID, ptr.Deref(req.ProviderID, ""))
-	return g.castClient.SendCloudEvent(ctx, req)
+	return g.notify(ctx, node, req, nil, notified)
 }
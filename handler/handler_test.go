@@ -3,9 +3,12 @@ package handler
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -13,10 +16,17 @@ import (
 
 	"github.com/stretchr/testify/require"
 	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes/fake"
+	ktest "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/record"
 
 	"github.com/castai/spot-handler/castai"
+	"github.com/castai/spot-handler/hooks"
+	"github.com/castai/spot-handler/notifier"
 )
 
 func TestRunLoop(t *testing.T) {
@@ -51,9 +61,9 @@ func TestRunLoop(t *testing.T) {
 		defer castS.Close()
 
 		fakeApi := fake.NewSimpleClientset(node)
-		castHttp, err := castai.NewRestyClient(castS.URL, "test", "", log.Level, 100*time.Millisecond, "0.0.0")
+		castHttp, err := castai.NewRestyClient(castS.URL, "test", castai.TLSConfig{}, log.Level, 100*time.Millisecond, "0.0.0")
 		r.NoError(err)
-		mockCastClient := castai.NewClient(log, castHttp, "test1")
+		mockCastClient := castai.NewClient(log, castHttp, "test1", castai.BatchConfig{})
 
 		mockInterrupt := &mockInterruptChecker{interrupted: true}
 		handler := SpotHandler{
@@ -106,9 +116,9 @@ func TestRunLoop(t *testing.T) {
 			},
 		}
 		fakeApi := fake.NewSimpleClientset(node2)
-		castHttp, err := castai.NewRestyClient(castS.URL, "test", "", log.Level, 100*time.Millisecond, "0.0.0")
+		castHttp, err := castai.NewRestyClient(castS.URL, "test", castai.TLSConfig{}, log.Level, 100*time.Millisecond, "0.0.0")
 		r.NoError(err)
-		mockCastClient := castai.NewClient(log, castHttp, "test2")
+		mockCastClient := castai.NewClient(log, castHttp, "test2", castai.BatchConfig{})
 
 		mockInterrupt := &mockInterruptChecker{interrupted: true}
 		handler := SpotHandler{
@@ -138,6 +148,508 @@ func TestRunLoop(t *testing.T) {
 		})
 	})
 
+	t.Run("taint already cordoned node and keep existing taints", func(t *testing.T) {
+		castS := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, re *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer castS.Close()
+
+		existingTaint := v1.Taint{
+			Key:    "node.kubernetes.io/unschedulable",
+			Effect: v1.TaintEffectNoSchedule,
+		}
+		cordonedNode := &v1.Node{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: nodeName,
+				Labels: map[string]string{
+					CastNodeIDLabel: castNodeID,
+					"other":         "label",
+				},
+			},
+			Spec: v1.NodeSpec{
+				Unschedulable: true,
+				Taints:        []v1.Taint{existingTaint},
+			},
+		}
+		fakeApi := fake.NewSimpleClientset(cordonedNode)
+		castHttp, err := castai.NewRestyClient(castS.URL, "test", castai.TLSConfig{}, log.Level, 100*time.Millisecond, "0.0.0")
+		r.NoError(err)
+		mockCastClient := castai.NewClient(log, castHttp, "test1", castai.BatchConfig{})
+
+		handler := SpotHandler{
+			pollWaitInterval:  100 * time.Millisecond,
+			metadataChecker:   &mockInterruptChecker{interrupted: true},
+			castClient:        mockCastClient,
+			nodeName:          nodeName,
+			clientset:         fakeApi,
+			log:               log,
+			phase2Permissions: true,
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+		defer cancel()
+
+		r.NoError(handler.Run(ctx))
+
+		got, err := fakeApi.CoreV1().Nodes().Get(context.Background(), nodeName, metav1.GetOptions{})
+		r.NoError(err)
+		r.True(got.Spec.Unschedulable)
+		r.Equal("label", got.Labels["other"])
+		r.Equal(valueNodeDrainingReasonInterrupted, got.Labels[labelNodeDraining])
+		r.ElementsMatch([]v1.Taint{
+			existingTaint,
+			{
+				Key:    taintNodeDraining,
+				Value:  valueTrue,
+				Effect: taintNodeDrainingEffect,
+			},
+		}, got.Spec.Taints)
+	})
+
+	t.Run("do not notify mothership nor taint node in dry-run mode", func(t *testing.T) {
+		mothershipCalls := 0
+		castS := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, re *http.Request) {
+			mothershipCalls++
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer castS.Close()
+
+		dryRunNode := node.DeepCopy()
+		dryRunNode.Spec = v1.NodeSpec{}
+		delete(dryRunNode.Labels, labelNodeDraining)
+		fakeApi := fake.NewSimpleClientset(dryRunNode)
+		castHttp, err := castai.NewRestyClient(castS.URL, "test", castai.TLSConfig{}, log.Level, 100*time.Millisecond, "0.0.0")
+		r.NoError(err)
+		mockCastClient := castai.NewClient(log, castHttp, "test1", castai.BatchConfig{})
+
+		handler := SpotHandler{
+			pollWaitInterval:  100 * time.Millisecond,
+			metadataChecker:   &mockInterruptChecker{interrupted: true, rebalanceRecommendation: true},
+			castClient:        mockCastClient,
+			nodeName:          nodeName,
+			clientset:         fakeApi,
+			log:               log,
+			phase2Permissions: true,
+			dryRun:            true,
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+		defer cancel()
+
+		r.NoError(handler.Run(ctx))
+		r.Equal(0, mothershipCalls)
+
+		got, err := fakeApi.CoreV1().Nodes().Get(context.Background(), nodeName, metav1.GetOptions{})
+		r.NoError(err)
+		r.False(got.Spec.Unschedulable)
+		r.Empty(got.Spec.Taints)
+	})
+
+	t.Run("notify webhook alongside mothership", func(t *testing.T) {
+		castS := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, re *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer castS.Close()
+
+		events := make(chan notifier.Event, 10)
+		webhookS := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, re *http.Request) {
+			var event notifier.Event
+			r.NoError(json.NewDecoder(re.Body).Decode(&event))
+			events <- event
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer webhookS.Close()
+
+		fakeApi := fake.NewSimpleClientset(node)
+		castHttp, err := castai.NewRestyClient(castS.URL, "test", castai.TLSConfig{}, log.Level, 100*time.Millisecond, "0.0.0")
+		r.NoError(err)
+		webhook, err := notifier.NewWebhook(notifier.WebhookConfig{URL: webhookS.URL})
+		r.NoError(err)
+
+		handler := SpotHandler{
+			pollWaitInterval: 100 * time.Millisecond,
+			metadataChecker:  &mockInterruptChecker{interrupted: true},
+			castClient:       castai.NewClient(log, castHttp, "test1", castai.BatchConfig{}),
+			notifiers:        []notifier.Notifier{webhook},
+			nodeName:         nodeName,
+			clientset:        fakeApi,
+			log:              log,
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+		defer cancel()
+
+		r.NoError(handler.Run(ctx))
+		r.Len(events, 1)
+		event := <-events
+		r.Equal(cloudEventInterrupted, event.Type)
+		r.Equal(nodeName, event.NodeName)
+		r.Equal(castNodeID, event.NodeID)
+	})
+
+	t.Run("do not notify webhook again when mothership notification is retried", func(t *testing.T) {
+		var mu sync.Mutex
+		var statuses []int
+		failUntil := time.Now().Add(250 * time.Millisecond)
+		castS := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, re *http.Request) {
+			status := http.StatusOK
+			if time.Now().Before(failUntil) {
+				status = http.StatusInternalServerError
+			}
+			mu.Lock()
+			statuses = append(statuses, status)
+			mu.Unlock()
+			w.WriteHeader(status)
+		}))
+		defer castS.Close()
+
+		events := make(chan notifier.Event, 10)
+		webhookS := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, re *http.Request) {
+			var event notifier.Event
+			r.NoError(json.NewDecoder(re.Body).Decode(&event))
+			events <- event
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer webhookS.Close()
+
+		castHttp, err := castai.NewRestyClient(castS.URL, "test", castai.TLSConfig{}, log.Level, 100*time.Millisecond, "0.0.0")
+		r.NoError(err)
+		webhook, err := notifier.NewWebhook(notifier.WebhookConfig{URL: webhookS.URL})
+		r.NoError(err)
+
+		handler := SpotHandler{
+			pollWaitInterval: 50 * time.Millisecond,
+			metadataChecker:  &mockInterruptChecker{interrupted: true},
+			castClient:       castai.NewClient(log, castHttp, "test1", castai.BatchConfig{}),
+			notifiers:        []notifier.Notifier{webhook},
+			nodeName:         nodeName,
+			clientset:        fake.NewSimpleClientset(node),
+			log:              log,
+			retryConfig:      RetryConfig{InitialInterval: 10 * time.Millisecond, MaxInterval: 20 * time.Millisecond, MaxElapsedTime: time.Second},
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+		defer cancel()
+
+		r.NoError(handler.Run(ctx))
+		mu.Lock()
+		defer mu.Unlock()
+		r.Contains(statuses, http.StatusInternalServerError)
+		r.Equal(http.StatusOK, statuses[len(statuses)-1])
+		r.Len(events, 1)
+	})
+
+	t.Run("do not retry mothership client errors", func(t *testing.T) {
+		var calls atomic.Int32
+		castS := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, re *http.Request) {
+			calls.Add(1)
+			w.WriteHeader(http.StatusBadRequest)
+		}))
+		defer castS.Close()
+
+		castHttp, err := castai.NewRestyClient(castS.URL, "test", castai.TLSConfig{}, log.Level, 100*time.Millisecond, "0.0.0")
+		r.NoError(err)
+		handler := SpotHandler{
+			pollWaitInterval: time.Minute,
+			metadataChecker:  &mockInterruptChecker{interrupted: true},
+			castClient:       castai.NewClient(log, castHttp, "test1", castai.BatchConfig{}),
+			nodeName:         nodeName,
+			clientset:        fake.NewSimpleClientset(node),
+			log:              log,
+			retryConfig:      RetryConfig{InitialInterval: 10 * time.Millisecond},
+		}
+
+		var state pollState
+		err = handler.poll(context.Background(), &state)
+		state.localActions.Wait()
+		var reqErr *castai.RequestError
+		r.ErrorAs(err, &reqErr)
+		r.Equal(http.StatusBadRequest, reqErr.StatusCode)
+		r.Equal(int32(1), calls.Load())
+	})
+
+	t.Run("bound mothership retries by poll interval", func(t *testing.T) {
+		castS := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, re *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		defer castS.Close()
+
+		castHttp, err := castai.NewRestyClient(castS.URL, "test", castai.TLSConfig{}, log.Level, 100*time.Millisecond, "0.0.0")
+		r.NoError(err)
+		handler := SpotHandler{
+			pollWaitInterval: 200 * time.Millisecond,
+			metadataChecker:  &mockInterruptChecker{interrupted: true},
+			castClient:       castai.NewClient(log, castHttp, "test1", castai.BatchConfig{}),
+			nodeName:         nodeName,
+			clientset:        fake.NewSimpleClientset(node),
+			log:              log,
+			retryConfig:      RetryConfig{InitialInterval: 10 * time.Millisecond, MaxElapsedTime: time.Hour},
+		}
+
+		var state pollState
+		start := time.Now()
+		r.Error(handler.poll(context.Background(), &state))
+		r.Less(time.Since(start), time.Second)
+		state.localActions.Wait()
+		r.Nil(state.interruption)
+	})
+
+	t.Run("give up mothership retries across polls once retry budget is spent", func(t *testing.T) {
+		castS := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, re *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		defer castS.Close()
+
+		castHttp, err := castai.NewRestyClient(castS.URL, "test", castai.TLSConfig{}, log.Level, 100*time.Millisecond, "0.0.0")
+		r.NoError(err)
+		handler := SpotHandler{
+			pollWaitInterval: 50 * time.Millisecond,
+			metadataChecker:  &mockInterruptChecker{interrupted: true},
+			castClient:       castai.NewClient(log, castHttp, "test1", castai.BatchConfig{}),
+			nodeName:         nodeName,
+			clientset:        fake.NewSimpleClientset(node),
+			log:              log,
+			retryConfig:      RetryConfig{InitialInterval: 10 * time.Millisecond, MaxElapsedTime: 200 * time.Millisecond},
+		}
+
+		var state pollState
+		r.Error(handler.poll(context.Background(), &state))
+		r.Nil(state.interruption)
+		r.Eventually(func() bool {
+			return handler.poll(context.Background(), &state) == nil
+		}, time.Second, 10*time.Millisecond)
+		state.localActions.Wait()
+		r.NotNil(state.interruption)
+	})
+
+	t.Run("taint node and notify webhook in standalone mode", func(t *testing.T) {
+		events := make(chan notifier.Event, 10)
+		webhookS := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, re *http.Request) {
+			var event notifier.Event
+			r.NoError(json.NewDecoder(re.Body).Decode(&event))
+			events <- event
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer webhookS.Close()
+
+		standaloneNode := node.DeepCopy()
+		standaloneNode.Spec = v1.NodeSpec{}
+		fakeApi := fake.NewSimpleClientset(standaloneNode)
+		webhook, err := notifier.NewWebhook(notifier.WebhookConfig{URL: webhookS.URL})
+		r.NoError(err)
+
+		handler := SpotHandler{
+			pollWaitInterval:  100 * time.Millisecond,
+			metadataChecker:   &mockInterruptChecker{interrupted: true},
+			notifiers:         []notifier.Notifier{webhook},
+			nodeName:          nodeName,
+			clientset:         fakeApi,
+			log:               log,
+			phase2Permissions: true,
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+		defer cancel()
+
+		r.NoError(handler.Run(ctx))
+		r.Len(events, 1)
+
+		got, err := fakeApi.CoreV1().Nodes().Get(context.Background(), nodeName, metav1.GetOptions{})
+		r.NoError(err)
+		r.True(got.Spec.Unschedulable)
+	})
+
+	t.Run("run pre-termination hooks once and record node events", func(t *testing.T) {
+		node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: nodeName, UID: "node-uid"}}
+		fakeApi := fake.NewSimpleClientset(node)
+		recorder := &refRecorder{FakeRecorder: record.NewFakeRecorder(10)}
+
+		handler := SpotHandler{
+			pollWaitInterval: 100 * time.Millisecond,
+			metadataChecker:  &mockInterruptChecker{interrupted: true},
+			nodeName:         nodeName,
+			clientset:        fakeApi,
+			log:              log,
+			hooks: hooks.NewRunner(log, fakeApi, nodeName, hooks.Config{
+				Commands: []hooks.CommandConfig{
+					{Name: "ok", Command: []string{"true"}},
+					{Name: "fail", Command: []string{"false"}},
+				},
+				Timeout: time.Second,
+			}),
+			recorder: recorder,
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+		defer cancel()
+
+		r.NoError(handler.Run(ctx))
+		r.Len(recorder.Events, 2)
+		events := map[string]bool{}
+		for len(recorder.Events) > 0 {
+			events[strings.Join(strings.Fields(<-recorder.Events)[:4], " ")] = true
+		}
+		r.Equal(map[string]bool{
+			"Normal PreTerminationHookSucceeded Hook command/ok": true,
+			"Warning PreTerminationHookFailed Hook command/fail": true,
+		}, events)
+		r.Len(recorder.refs, 2)
+		for _, ref := range recorder.refs {
+			r.Equal(&v1.ObjectReference{Kind: "Node", Name: nodeName, UID: "node-uid"}, ref)
+		}
+	})
+
+	t.Run("run hooks without waiting for pod annotations", func(t *testing.T) {
+		fakeApi := fake.NewSimpleClientset(node, &v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "pod", Namespace: "default"},
+			Spec:       v1.PodSpec{NodeName: nodeName},
+			Status:     v1.PodStatus{Phase: v1.PodRunning},
+		})
+		fakeApi.PrependReactor("patch", "pods", func(action ktest.Action) (bool, runtime.Object, error) {
+			return true, nil, apierrors.NewServiceUnavailable("overloaded")
+		})
+		recorder := record.NewFakeRecorder(10)
+
+		handler := SpotHandler{
+			pollWaitInterval: 50 * time.Millisecond,
+			metadataChecker:  &mockInterruptChecker{interrupted: true},
+			nodeName:         nodeName,
+			clientset:        fakeApi,
+			log:              log,
+			podAnnotations:   true,
+			retryConfig:      RetryConfig{InitialInterval: 10 * time.Millisecond, MaxInterval: 20 * time.Millisecond},
+			hooks: hooks.NewRunner(log, fakeApi, nodeName, hooks.Config{
+				Commands: []hooks.CommandConfig{{Name: "ok", Command: []string{"true"}}},
+				Timeout:  time.Second,
+			}),
+			recorder: recorder,
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		start := time.Now()
+		hookDone := make(chan time.Duration, 1)
+		go func() {
+			<-recorder.Events
+			hookDone <- time.Since(start)
+		}()
+
+		r.NoError(handler.Run(ctx))
+		r.Less(<-hookDone, 500*time.Millisecond)
+	})
+
+	t.Run("drain node without waiting for hooks", func(t *testing.T) {
+		fakeApi := fake.NewSimpleClientset(node)
+		cordoned := make(chan time.Duration, 1)
+		start := time.Now()
+		fakeApi.PrependReactor("patch", "nodes", func(action ktest.Action) (bool, runtime.Object, error) {
+			select {
+			case cordoned <- time.Since(start):
+			default:
+			}
+			return false, nil, nil
+		})
+
+		handler := SpotHandler{
+			pollWaitInterval:  time.Minute,
+			metadataChecker:   &mockInterruptChecker{interrupted: true},
+			nodeName:          nodeName,
+			clientset:         fakeApi,
+			log:               log,
+			phase2Permissions: true,
+			drain:             DrainConfig{Enabled: true, Timeout: time.Second},
+			hooks: hooks.NewRunner(log, fakeApi, nodeName, hooks.Config{
+				Commands: []hooks.CommandConfig{{Name: "slow", Command: []string{"sleep", "1"}}},
+				Timeout:  2 * time.Second,
+			}),
+		}
+
+		var state pollState
+		_ = handler.poll(context.Background(), &state)
+		state.localActions.Wait()
+		r.Less(<-cordoned, 500*time.Millisecond)
+	})
+
+	t.Run("annotate pods on the node with termination time", func(t *testing.T) {
+		terminationTime := time.Now().Add(2 * time.Minute).UTC().Truncate(time.Second)
+		newPod := func(name, nodeName string, phase v1.PodPhase) *v1.Pod {
+			return &v1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Annotations: map[string]string{"existing": "value"}},
+				Spec:       v1.PodSpec{NodeName: nodeName},
+				Status:     v1.PodStatus{Phase: phase},
+			}
+		}
+		fakeApi := fake.NewSimpleClientset(
+			node,
+			newPod("running", nodeName, v1.PodRunning),
+			newPod("completed", nodeName, v1.PodSucceeded),
+			newPod("other-node", "other", v1.PodRunning),
+		)
+
+		handler := SpotHandler{
+			pollWaitInterval: 100 * time.Millisecond,
+			metadataChecker: &mockNoticeChecker{notices: []*InterruptNotice{
+				{Status: NoticeStatusScheduled, Time: terminationTime},
+			}},
+			nodeName:       nodeName,
+			clientset:      fakeApi,
+			log:            log,
+			podAnnotations: true,
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+		defer cancel()
+
+		r.NoError(handler.Run(ctx))
+
+		pod, err := fakeApi.CoreV1().Pods("default").Get(context.Background(), "running", metav1.GetOptions{})
+		r.NoError(err)
+		r.Equal(map[string]string{
+			"existing":                "value",
+			AnnotationInterrupted:     valueTrue,
+			AnnotationTerminationTime: terminationTime.Format(time.RFC3339),
+		}, pod.Annotations)
+
+		for _, name := range []string{"completed", "other-node"} {
+			pod, err := fakeApi.CoreV1().Pods("default").Get(context.Background(), name, metav1.GetOptions{})
+			r.NoError(err)
+			r.NotContains(pod.Annotations, AnnotationInterrupted)
+		}
+	})
+
+	t.Run("apply reconfigured poll interval and dry-run", func(t *testing.T) {
+		mothershipCalls := make(chan struct{}, 10)
+		castS := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, re *http.Request) {
+			mothershipCalls <- struct{}{}
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer castS.Close()
+
+		fakeApi := fake.NewSimpleClientset(node)
+		castHttp, err := castai.NewRestyClient(castS.URL, "test", castai.TLSConfig{}, log.Level, 100*time.Millisecond, "0.0.0")
+		r.NoError(err)
+
+		handler := SpotHandler{
+			pollWaitInterval: time.Hour,
+			metadataChecker:  &mockInterruptChecker{interrupted: true},
+			castClient:       castai.NewClient(log, castHttp, "test1", castai.BatchConfig{}),
+			nodeName:         nodeName,
+			clientset:        fakeApi,
+			log:              log,
+			dryRun:           true,
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+		defer cancel()
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			handler.Reconfigure(RuntimeConfig{PollInterval: 100 * time.Millisecond})
+		}()
+
+		r.NoError(handler.Run(ctx))
+		r.Len(mothershipCalls, 1)
+	})
+
 	t.Run("keep checking interruption on context canceled", func(t *testing.T) {
 		mothershipCalls := 0
 		castS := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, re *http.Request) {
@@ -150,9 +662,9 @@ func TestRunLoop(t *testing.T) {
 		defer castS.Close()
 
 		fakeApi := fake.NewSimpleClientset(node)
-		castHttp, err := castai.NewRestyClient(castS.URL, "test", "", log.Level, 100*time.Millisecond, "0.0.0")
+		castHttp, err := castai.NewRestyClient(castS.URL, "test", castai.TLSConfig{}, log.Level, 100*time.Millisecond, "0.0.0")
 		r.NoError(err)
-		mockCastClient := castai.NewClient(log, castHttp, "test1")
+		mockCastClient := castai.NewClient(log, castHttp, "test1", castai.BatchConfig{})
 
 		mockInterrupt := &mockInterruptChecker{interrupted: true}
 		handler := SpotHandler{
@@ -208,9 +720,9 @@ func TestRunLoop(t *testing.T) {
 		defer castS.Close()
 
 		fakeApi := fake.NewSimpleClientset(node)
-		castHttp, err := castai.NewRestyClient(castS.URL, "test", "", log.Level, time.Millisecond*100, "0.0.0")
+		castHttp, err := castai.NewRestyClient(castS.URL, "test", castai.TLSConfig{}, log.Level, time.Millisecond*100, "0.0.0")
 		r.NoError(err)
-		mockCastClient := castai.NewClient(log, castHttp, "test1")
+		mockCastClient := castai.NewClient(log, castHttp, "test1", castai.BatchConfig{})
 
 		mockInterrupt := &mockInterruptChecker{interrupted: true}
 		handler := SpotHandler{
@@ -220,6 +732,7 @@ func TestRunLoop(t *testing.T) {
 			nodeName:         nodeName,
 			clientset:        fakeApi,
 			log:              log,
+			retryConfig:      RetryConfig{InitialInterval: 10 * time.Millisecond},
 		}
 
 		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
@@ -244,9 +757,9 @@ func TestRunLoop(t *testing.T) {
 		defer castS.Close()
 
 		fakeApi := fake.NewSimpleClientset(node)
-		castHttp, err := castai.NewRestyClient(castS.URL, "test", "", log.Level, 100*time.Millisecond, "0.0.0")
+		castHttp, err := castai.NewRestyClient(castS.URL, "test", castai.TLSConfig{}, log.Level, 100*time.Millisecond, "0.0.0")
 		r.NoError(err)
-		mockCastClient := castai.NewClient(log, castHttp, "test1")
+		mockCastClient := castai.NewClient(log, castHttp, "test1", castai.BatchConfig{})
 
 		mockRecommendation := &mockInterruptChecker{rebalanceRecommendation: true}
 		handler := SpotHandler{
@@ -294,9 +807,9 @@ func TestRunLoop(t *testing.T) {
 		defer castS.Close()
 
 		fakeApi := fake.NewSimpleClientset(nodeWithProviderID)
-		castHttp, err := castai.NewRestyClient(castS.URL, "test", "", log.Level, 100*time.Millisecond, "0.0.0")
+		castHttp, err := castai.NewRestyClient(castS.URL, "test", castai.TLSConfig{}, log.Level, 100*time.Millisecond, "0.0.0")
 		r.NoError(err)
-		mockCastClient := castai.NewClient(log, castHttp, "test1")
+		mockCastClient := castai.NewClient(log, castHttp, "test1", castai.BatchConfig{})
 
 		mockInterrupt := &mockInterruptChecker{interrupted: true}
 		handler := SpotHandler{
@@ -344,9 +857,9 @@ func TestRunLoop(t *testing.T) {
 		defer castS.Close()
 
 		fakeApi := fake.NewSimpleClientset(nodeWithProviderID)
-		castHttp, err := castai.NewRestyClient(castS.URL, "test", "", log.Level, 100*time.Millisecond, "0.0.0")
+		castHttp, err := castai.NewRestyClient(castS.URL, "test", castai.TLSConfig{}, log.Level, 100*time.Millisecond, "0.0.0")
 		r.NoError(err)
-		mockCastClient := castai.NewClient(log, castHttp, "test1")
+		mockCastClient := castai.NewClient(log, castHttp, "test1", castai.BatchConfig{})
 
 		mockRecommendation := &mockInterruptChecker{rebalanceRecommendation: true}
 		handler := SpotHandler{
@@ -398,9 +911,9 @@ func TestRunLoop(t *testing.T) {
 		defer castS.Close()
 
 		fakeApi := fake.NewSimpleClientset(nodeWithOverride)
-		castHttp, err := castai.NewRestyClient(castS.URL, "test", "", log.Level, 100*time.Millisecond, "0.0.0")
+		castHttp, err := castai.NewRestyClient(castS.URL, "test", castai.TLSConfig{}, log.Level, 100*time.Millisecond, "0.0.0")
 		r.NoError(err)
-		mockCastClient := castai.NewClient(log, castHttp, "test1")
+		mockCastClient := castai.NewClient(log, castHttp, "test1", castai.BatchConfig{})
 
 		mockInterrupt := &mockInterruptChecker{interrupted: true}
 		handler := SpotHandler{
@@ -452,9 +965,9 @@ func TestRunLoop(t *testing.T) {
 		defer castS.Close()
 
 		fakeApi := fake.NewSimpleClientset(nodeWithOverride)
-		castHttp, err := castai.NewRestyClient(castS.URL, "test", "", log.Level, 100*time.Millisecond, "0.0.0")
+		castHttp, err := castai.NewRestyClient(castS.URL, "test", castai.TLSConfig{}, log.Level, 100*time.Millisecond, "0.0.0")
 		r.NoError(err)
-		mockCastClient := castai.NewClient(log, castHttp, "test1")
+		mockCastClient := castai.NewClient(log, castHttp, "test1", castai.BatchConfig{})
 
 		mockRecommendation := &mockInterruptChecker{rebalanceRecommendation: true}
 		handler := SpotHandler{
@@ -473,6 +986,234 @@ func TestRunLoop(t *testing.T) {
 		require.NoError(t, err)
 		r.Equal(1, mothershipCalls)
 	})
+
+	t.Run("send follow-up events after interruption", func(t *testing.T) {
+		m := sync.Mutex{}
+		var events []string
+		castS := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, re *http.Request) {
+			var req castai.CloudEventRequest
+			r.NoError(json.NewDecoder(re.Body).Decode(&req))
+			r.Equal(castNodeID, req.NodeID)
+			m.Lock()
+			events = append(events, req.EventType)
+			m.Unlock()
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer castS.Close()
+
+		fakeApi := fake.NewSimpleClientset(node)
+		castHttp, err := castai.NewRestyClient(castS.URL, "test", castai.TLSConfig{}, log.Level, 100*time.Millisecond, "0.0.0")
+		r.NoError(err)
+		mockCastClient := castai.NewClient(log, castHttp, "test1", castai.BatchConfig{})
+
+		noticeTime := time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)
+		mockNotice := &mockNoticeChecker{
+			notices: []*InterruptNotice{
+				{Status: NoticeStatusScheduled, Time: noticeTime},
+				{Status: NoticeStatusScheduled, Time: noticeTime},
+				{Status: NoticeStatusScheduled, Time: noticeTime.Add(time.Minute)},
+				{Status: NoticeStatusStarted},
+				nil,
+			},
+		}
+		handler := SpotHandler{
+			pollWaitInterval: 50 * time.Millisecond,
+			metadataChecker:  mockNotice,
+			castClient:       mockCastClient,
+			nodeName:         nodeName,
+			clientset:        fakeApi,
+			log:              log,
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		err = handler.Run(ctx)
+		r.NoError(err)
+		r.Equal([]string{
+			cloudEventInterrupted,
+			cloudEventInterruptionTimeChanged,
+			cloudEventInterruptionStarted,
+			cloudEventInterruptionCompleted,
+		}, events)
+	})
+
+	t.Run("ignore notice flapping after interruption completed", func(t *testing.T) {
+		m := sync.Mutex{}
+		var events []string
+		castS := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, re *http.Request) {
+			var req castai.CloudEventRequest
+			r.NoError(json.NewDecoder(re.Body).Decode(&req))
+			m.Lock()
+			events = append(events, req.EventType)
+			m.Unlock()
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer castS.Close()
+
+		fakeApi := fake.NewSimpleClientset(&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: nodeName}})
+		var patches atomic.Int32
+		fakeApi.PrependReactor("patch", "nodes", func(action ktest.Action) (bool, runtime.Object, error) {
+			// Taints are patched, other node fields are applied.
+			if action.(ktest.PatchAction).GetPatchType() == types.StrategicMergePatchType {
+				patches.Add(1)
+			}
+			return false, nil, nil
+		})
+		castHttp, err := castai.NewRestyClient(castS.URL, "test", castai.TLSConfig{}, log.Level, 100*time.Millisecond, "0.0.0")
+		r.NoError(err)
+
+		noticeTime := time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)
+		mockNotice := &mockNoticeChecker{
+			notices: []*InterruptNotice{
+				{Status: NoticeStatusScheduled, Time: noticeTime},
+				nil,
+				{Status: NoticeStatusScheduled, Time: noticeTime},
+				nil,
+			},
+		}
+		handler := SpotHandler{
+			pollWaitInterval:  50 * time.Millisecond,
+			metadataChecker:   mockNotice,
+			castClient:        castai.NewClient(log, castHttp, "test1", castai.BatchConfig{}),
+			nodeName:          nodeName,
+			clientset:         fakeApi,
+			log:               log,
+			phase2Permissions: true,
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+		defer cancel()
+
+		r.NoError(handler.Run(ctx))
+		r.Equal([]string{cloudEventInterrupted, cloudEventInterruptionCompleted}, events)
+		r.Equal(int32(1), patches.Load())
+	})
+
+	t.Run("pass caller context to metadata checks", func(t *testing.T) {
+		type ctxKey struct{}
+
+		checker := &mockContextChecker{key: ctxKey{}}
+		handler := SpotHandler{
+			pollWaitInterval: 50 * time.Millisecond,
+			gracePeriod:      200 * time.Millisecond,
+			metadataChecker:  checker,
+			nodeName:         nodeName,
+			clientset:        fake.NewSimpleClientset(node),
+			log:              log,
+		}
+
+		ctx, cancel := context.WithTimeout(context.WithValue(context.Background(), ctxKey{}, "value"), 200*time.Millisecond)
+		defer cancel()
+
+		start := time.Now()
+		r.NoError(handler.Run(ctx))
+		r.Less(time.Since(start), time.Second)
+
+		checker.m.Lock()
+		defer checker.m.Unlock()
+		r.NotEmpty(checker.values)
+		for _, v := range checker.values {
+			r.Equal("value", v)
+		}
+	})
+}
+
+func TestTaintNode(t *testing.T) {
+	r := require.New(t)
+	nodeName := "AI"
+	foreign := v1.Taint{Key: "foreign", Value: "value", Effect: v1.TaintEffectNoSchedule}
+	added := v1.Taint{Key: "added-meanwhile", Effect: v1.TaintEffectNoSchedule}
+
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: nodeName, ResourceVersion: "1"},
+		Spec:       v1.NodeSpec{Taints: []v1.Taint{foreign}},
+	}
+	fakeApi := fake.NewSimpleClientset(node)
+	conflicted := false
+	var applied []string
+	fakeApi.PrependReactor("patch", "nodes", func(action ktest.Action) (bool, runtime.Object, error) {
+		patch := action.(ktest.PatchAction)
+		if patch.GetPatchType() == types.ApplyPatchType {
+			applied = append(applied, string(patch.GetPatch()))
+			return false, nil, nil
+		}
+		if !conflicted {
+			// Taint added by someone else since the node was read.
+			conflicted = true
+			changed := node.DeepCopy()
+			changed.ResourceVersion = "2"
+			changed.Spec.Taints = append(changed.Spec.Taints, added)
+			r.NoError(fakeApi.Tracker().Update(v1.SchemeGroupVersion.WithResource("nodes"), changed, ""))
+			return true, nil, apierrors.NewConflict(v1.Resource("nodes"), nodeName, errors.New("resource version changed"))
+		}
+		return false, nil, nil
+	})
+
+	handler := SpotHandler{
+		clientset:   fakeApi,
+		nodeName:    nodeName,
+		log:         logrus.New(),
+		retryConfig: RetryConfig{InitialInterval: time.Millisecond},
+	}
+	r.NoError(handler.taintNode(context.Background(), node))
+
+	got, err := fakeApi.CoreV1().Nodes().Get(context.Background(), nodeName, metav1.GetOptions{})
+	r.NoError(err)
+	r.True(conflicted)
+	r.ElementsMatch([]v1.Taint{foreign, added, drainingTaint()}, got.Spec.Taints)
+	r.True(got.Spec.Unschedulable)
+	r.Len(applied, 1)
+	r.NotContains(applied[0], "taints")
+}
+
+// refRecorder keeps objects events are recorded for.
+type refRecorder struct {
+	*record.FakeRecorder
+
+	mu   sync.Mutex
+	refs []runtime.Object
+}
+
+func (r *refRecorder) Eventf(object runtime.Object, eventtype, reason, messageFmt string, args ...interface{}) {
+	r.mu.Lock()
+	r.refs = append(r.refs, object)
+	r.mu.Unlock()
+	r.FakeRecorder.Eventf(object, eventtype, reason, messageFmt, args...)
+}
+
+type mockContextChecker struct {
+	mockInterruptChecker
+
+	key    any
+	m      sync.Mutex
+	values []any
+}
+
+func (m *mockContextChecker) CheckInterrupt(ctx context.Context) (bool, error) {
+	m.m.Lock()
+	defer m.m.Unlock()
+	m.values = append(m.values, ctx.Value(m.key))
+	return false, nil
+}
+
+type mockNoticeChecker struct {
+	mockInterruptChecker
+
+	m       sync.Mutex
+	notices []*InterruptNotice
+}
+
+// GetInterruptNotice returns configured notices in order, the last one is repeated.
+func (m *mockNoticeChecker) GetInterruptNotice(ctx context.Context) (*InterruptNotice, error) {
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	n := m.notices[0]
+	if len(m.notices) > 1 {
+		m.notices = m.notices[1:]
+	}
+	return n, nil
 }
 
 type mockInterruptChecker struct {
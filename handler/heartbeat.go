@@ -0,0 +1,138 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+
+	"github.com/castai/spot-handler/castai"
+	"github.com/castai/spot-handler/metrics"
+)
+
+const (
+	// heartbeatTimeout bounds a single heartbeat, failed heartbeats are not retried until the next interval.
+	heartbeatTimeout = 10 * time.Second
+	// maxHeartbeatSkips caps the number of intervals skipped while the mothership doesn't support heartbeats.
+	maxHeartbeatSkips = 60
+)
+
+// handlerStats are reported in heartbeats so that the platform can flag nodes with unhealthy handlers.
+type handlerStats struct {
+	mu               sync.Mutex
+	lastPoll         time.Time
+	metadataErrors   int64
+	mothershipErrors int64
+}
+
+// polled records the result of a metadata service check.
+func (s *handlerStats) polled(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		s.metadataErrors++
+		return
+	}
+	s.lastPoll = time.Now()
+}
+
+func (s *handlerStats) mothershipFailed() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.mothershipErrors++
+}
+
+// heartbeatState is kept between heartbeats.
+type heartbeatState struct {
+	// nodeID is looked up until it's found, the CAST AI node ID label doesn't change.
+	nodeID string
+	// notFound counts heartbeats rejected in a row because the mothership doesn't know the endpoint yet, e.g. before
+	// it's rolled out. Twice as many intervals are skipped after each of them.
+	notFound int
+	skip     int
+}
+
+// runHeartbeat sends heartbeats on start and then every heartbeat interval until stop is closed. Heartbeats back
+// off while the mothership doesn't support them.
+func (g *SpotHandler) runHeartbeat(ctx context.Context, stop <-chan struct{}) {
+	// Heartbeats continue during the shutdown grace period while the handler keeps polling.
+	ctx = context.WithoutCancel(ctx)
+	t := time.NewTicker(g.heartbeatInterval)
+	defer t.Stop()
+
+	var state heartbeatState
+	for {
+		if state.skip > 0 {
+			state.skip--
+		} else {
+			g.sendHeartbeat(ctx, &state)
+		}
+		select {
+		case <-stop:
+			return
+		case <-t.C:
+		}
+	}
+}
+
+func (g *SpotHandler) sendHeartbeat(ctx context.Context, state *heartbeatState) {
+	if g.isDryRun() {
+		g.log.Debug("dry-run: would send heartbeat to mothership")
+		metrics.DryRunAction(operationSendHeartbeat)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, heartbeatTimeout)
+	defer cancel()
+
+	req := &castai.HeartbeatRequest{
+		NodeName: g.nodeName,
+		Handler:  g.cloudEventHandler(),
+	}
+	if state.nodeID == "" {
+		state.nodeID = g.heartbeatNodeID(ctx)
+	}
+	req.NodeID = state.nodeID
+	g.stats.mu.Lock()
+	if !g.stats.lastPoll.IsZero() {
+		req.LastSuccessfulPollAt = ptr.To(g.stats.lastPoll.UTC())
+	}
+	req.MetadataErrors = g.stats.metadataErrors
+	req.MothershipErrors = g.stats.mothershipErrors
+	g.stats.mu.Unlock()
+
+	err := g.castClient.SendHeartbeat(ctx, req)
+	var reqErr *castai.RequestError
+	if errors.As(err, &reqErr) && reqErr.StatusCode == http.StatusNotFound {
+		state.notFound++
+		state.skip = min(1<<min(state.notFound, 6), maxHeartbeatSkips)
+		g.log.Infof("mothership doesn't support heartbeats, retrying in %d intervals", state.skip+1)
+		return
+	}
+	state.notFound = 0
+	if err != nil {
+		metrics.OperationFailed(operationSendHeartbeat)
+		g.stats.mothershipFailed()
+		g.log.Warnf("sending heartbeat: %v", err)
+	}
+}
+
+// heartbeatNodeID returns the CAST AI node ID, empty if the node can't be read. The node is read without retries, as
+// heartbeats are sent again on the next interval anyway.
+func (g *SpotHandler) heartbeatNodeID(ctx context.Context) string {
+	if g.nodeCache != nil {
+		if node, ok := g.nodeCache.get(g.nodeName); ok {
+			return node.Labels[CastNodeIDLabel]
+		}
+	}
+	node, err := g.clientset.CoreV1().Nodes().Get(ctx, g.nodeName, metav1.GetOptions{})
+	if err != nil {
+		g.log.Debugf("getting node for heartbeat: %v", err)
+		return ""
+	}
+	return node.Labels[CastNodeIDLabel]
+}
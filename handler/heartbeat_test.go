@@ -0,0 +1,117 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/castai/spot-handler/castai"
+)
+
+func TestHeartbeat(t *testing.T) {
+	log := logrus.New()
+
+	run := func(t *testing.T, dryRun bool, status int, interval, runFor time.Duration) []castai.HeartbeatRequest {
+		r := require.New(t)
+
+		var mu sync.Mutex
+		var heartbeats []castai.HeartbeatRequest
+		castS := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, re *http.Request) {
+			r.True(strings.HasSuffix(re.URL.Path, "/spot-handler/heartbeat"))
+			var req castai.HeartbeatRequest
+			r.NoError(json.NewDecoder(re.Body).Decode(&req))
+			mu.Lock()
+			heartbeats = append(heartbeats, req)
+			mu.Unlock()
+			w.WriteHeader(status)
+		}))
+		defer castS.Close()
+
+		castHttp, err := castai.NewRestyClient(castS.URL, "test", castai.TLSConfig{}, log.Level, 100*time.Millisecond, "0.0.0")
+		r.NoError(err)
+
+		handler := SpotHandler{
+			pollWaitInterval: 50 * time.Millisecond,
+			metadataChecker:  &failingChecker{failures: 2},
+			castClient:       castai.NewClient(log, castHttp, "test1", castai.BatchConfig{}),
+			nodeName:         "AI",
+			clientset: fake.NewSimpleClientset(&v1.Node{
+				ObjectMeta: metav1.ObjectMeta{Name: "AI", Labels: map[string]string{CastNodeIDLabel: "CAST"}},
+			}),
+			log:               log,
+			dryRun:            dryRun,
+			handlerVersion:    "v1.2.3",
+			provider:          "gcp",
+			heartbeatInterval: interval,
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), runFor)
+		defer cancel()
+		r.NoError(handler.Run(ctx))
+
+		mu.Lock()
+		defer mu.Unlock()
+		return heartbeats
+	}
+
+	t.Run("send heartbeats with poll stats", func(t *testing.T) {
+		r := require.New(t)
+
+		heartbeats := run(t, false, http.StatusOK, 200*time.Millisecond, 500*time.Millisecond)
+		r.Len(heartbeats, 3)
+
+		first := heartbeats[0]
+		r.Equal("AI", first.NodeName)
+		r.Equal("CAST", first.NodeID)
+		r.Equal(&castai.CloudEventHandler{Version: "v1.2.3", Provider: "gcp"}, first.Handler)
+		r.Nil(first.LastSuccessfulPollAt)
+		r.Zero(first.MetadataErrors)
+
+		last := heartbeats[len(heartbeats)-1]
+		r.NotNil(last.LastSuccessfulPollAt)
+		r.WithinDuration(time.Now(), *last.LastSuccessfulPollAt, time.Second)
+		r.Equal(int64(2), last.MetadataErrors)
+		r.Zero(last.MothershipErrors)
+	})
+
+	t.Run("do not send heartbeats in dry-run", func(t *testing.T) {
+		require.Empty(t, run(t, true, http.StatusOK, 200*time.Millisecond, 500*time.Millisecond))
+	})
+
+	t.Run("back off while mothership doesn't support heartbeats", func(t *testing.T) {
+		// Sent on ticks 0, 3, 8 and 17, skipping 2, 4 and 8 intervals.
+		heartbeats := run(t, false, http.StatusNotFound, 50*time.Millisecond, time.Second)
+		require.GreaterOrEqual(t, len(heartbeats), 3)
+		require.LessOrEqual(t, len(heartbeats), 4)
+	})
+}
+
+// failingChecker fails the first checks and reports no interruption afterwards.
+type failingChecker struct {
+	mockInterruptChecker
+
+	m        sync.Mutex
+	failures int
+}
+
+func (c *failingChecker) CheckInterrupt(_ context.Context) (bool, error) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	if c.failures > 0 {
+		c.failures--
+		return false, errors.New("metadata service unavailable")
+	}
+	return false, nil
+}
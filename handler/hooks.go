@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"context"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+
+	"github.com/castai/spot-handler/metrics"
+)
+
+const (
+	operationRunHooks = "run_hooks"
+
+	eventReasonHookSucceeded = "PreTerminationHookSucceeded"
+	eventReasonHookFailed    = "PreTerminationHookFailed"
+)
+
+// runHooks runs pre-termination hooks bounded by the interruption time. Hooks keep running after the termination
+// signal, as it's usually the node shutdown they are preparing for. They run alongside draining, so that slow hooks
+// don't use up the time left for evictions.
+func (g *SpotHandler) runHooks(ctx context.Context, notice *InterruptNotice) {
+	if g.hooks == nil || !g.hooks.Enabled() {
+		return
+	}
+	if g.isDryRun() {
+		g.log.Infof("dry-run: would run pre-termination hooks")
+		metrics.DryRunAction(operationRunHooks)
+		return
+	}
+
+	ctx = context.WithoutCancel(ctx)
+	if notice != nil && notice.Time.After(time.Now()) {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, notice.Time)
+		defer cancel()
+	}
+
+	g.log.Infof("running pre-termination hooks")
+	results := g.hooks.Run(ctx)
+	// Node is read once hooks are done, so that a slow API server doesn't delay them.
+	node := g.eventNode(ctx)
+	for _, res := range results {
+		if res.Err != nil {
+			g.log.Errorf("pre-termination hook %s failed after %s: %v", res.Hook, res.Duration, res.Err)
+			metrics.OperationFailed(operationRunHooks)
+			g.recordNodeEvent(node, v1.EventTypeWarning, eventReasonHookFailed, "Hook %s failed after %s: %v", res.Hook, res.Duration, res.Err)
+			continue
+		}
+		g.log.Infof("pre-termination hook %s succeeded in %s", res.Hook, res.Duration)
+		g.recordNodeEvent(node, v1.EventTypeNormal, eventReasonHookSucceeded, "Hook %s succeeded in %s", res.Hook, res.Duration)
+	}
+}
+
+// eventNode returns the node events are recorded for, nil if events are disabled or the node can't be read.
+func (g *SpotHandler) eventNode(ctx context.Context) *v1.Node {
+	if g.recorder == nil {
+		return nil
+	}
+	node, err := g.getNode(ctx)
+	if err != nil {
+		g.log.Warnf("skipping node events: %v", err)
+		return nil
+	}
+	return node
+}
+
+// recordNodeEvent records event of the node, nil node is ignored.
+func (g *SpotHandler) recordNodeEvent(node *v1.Node, eventType, reason, messageFmt string, args ...interface{}) {
+	if g.recorder == nil || node == nil {
+		return
+	}
+	ref := &v1.ObjectReference{
+		Kind: "Node",
+		Name: node.Name,
+		UID:  node.UID,
+	}
+	g.recorder.Eventf(ref, eventType, reason, messageFmt, args...)
+}
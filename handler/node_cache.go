@@ -0,0 +1,48 @@
+package handler
+
+import (
+	"github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	coreinformers "k8s.io/client-go/informers/core/v1"
+	"k8s.io/client-go/kubernetes"
+	listersv1 "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// nodeCache keeps the handler's node up to date using a single-object informer, so that reacting to a notice
+// doesn't depend on the API server latency at the moment many nodes are interrupted at once.
+type nodeCache struct {
+	informer cache.SharedIndexInformer
+	lister   listersv1.NodeLister
+}
+
+func newNodeCache(clientset kubernetes.Interface, nodeName string) *nodeCache {
+	informer := coreinformers.NewFilteredNodeInformer(clientset, 0, cache.Indexers{}, func(opts *metav1.ListOptions) {
+		opts.FieldSelector = fields.OneTermEqualSelector("metadata.name", nodeName).String()
+	})
+	return &nodeCache{
+		informer: informer,
+		lister:   listersv1.NewNodeLister(informer.GetIndexer()),
+	}
+}
+
+func (c *nodeCache) run(log logrus.FieldLogger, stopCh <-chan struct{}) {
+	go c.informer.Run(stopCh)
+	if cache.WaitForCacheSync(stopCh, c.informer.HasSynced) {
+		log.Debug("node cache synced")
+	}
+}
+
+// get returns a copy of the cached node. False is returned if the cache is not synced yet or node is not found.
+func (c *nodeCache) get(name string) (*v1.Node, bool) {
+	if !c.informer.HasSynced() {
+		return nil, false
+	}
+	node, err := c.lister.Get(name)
+	if err != nil {
+		return nil, false
+	}
+	return node.DeepCopy(), true
+}
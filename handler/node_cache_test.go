@@ -0,0 +1,60 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestNodeCache(t *testing.T) {
+	r := require.New(t)
+	log := logrus.New()
+
+	nodeName := "AI"
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: nodeName,
+			Labels: map[string]string{
+				CastNodeIDLabel: "CAST",
+			},
+		},
+	}
+
+	fakeApi := fake.NewSimpleClientset(node)
+	// Node must be served from the cache, API server lookups fail.
+	fakeApi.PrependReactor("get", "nodes", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("api server overloaded")
+	})
+
+	handler := SpotHandler{
+		clientset:   fakeApi,
+		nodeCache:   newNodeCache(fakeApi, nodeName),
+		nodeName:    nodeName,
+		log:         log,
+		retryConfig: RetryConfig{InitialInterval: time.Millisecond, MaxElapsedTime: 100 * time.Millisecond},
+	}
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go handler.nodeCache.run(log, stopCh)
+
+	r.Eventually(func() bool {
+		return handler.nodeCache.informer.HasSynced()
+	}, time.Second, 10*time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	got, err := handler.getNode(ctx)
+	r.NoError(err)
+	r.Equal("CAST", got.Labels[CastNodeIDLabel])
+}
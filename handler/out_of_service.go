@@ -0,0 +1,124 @@
+package handler
+
+import (
+	"context"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+
+	"github.com/castai/spot-handler/metrics"
+)
+
+const (
+	taintOutOfService       = "node.kubernetes.io/out-of-service"
+	taintOutOfServiceValue  = "nodeshutdown"
+	taintOutOfServiceEffect = v1.TaintEffectNoExecute
+
+	eventReasonOutOfService        = "SpotOutOfService"
+	eventReasonOutOfServiceRemoved = "SpotOutOfServiceRemoved"
+)
+
+func outOfServiceTaint() v1.Taint {
+	return v1.Taint{Key: taintOutOfService, Value: taintOutOfServiceValue, Effect: taintOutOfServiceEffect}
+}
+
+// outOfServiceSupported returns false if the cluster version is unknown or too old for the out-of-service taint.
+func (g *SpotHandler) outOfServiceSupported() bool {
+	return g.capabilities().OutOfServiceTaint
+}
+
+// outOfServiceDue returns true once the interruption time has passed. The node must also be shut down for the taint
+// to be applied, see handleOutOfService.
+func (g *SpotHandler) outOfServiceDue(notice *InterruptNotice) bool {
+	if !g.outOfServiceTaint || !g.phase2Permissions || notice.Time.IsZero() {
+		return false
+	}
+	return !time.Now().Before(notice.Time)
+}
+
+// handleOutOfService taints the node out-of-service once it's shut down after the interruption, so that the control
+// plane force deletes its pods and detaches their volumes without waiting for the attach-detach controller timeout.
+// The taint is never applied while the node is ready, as force detaching volumes of a running VM can corrupt data.
+// Returns false if the node is still ready and the taint has to be applied later.
+func (g *SpotHandler) handleOutOfService(ctx context.Context, notice *InterruptNotice) (bool, error) {
+	if !g.outOfServiceSupported() {
+		g.log.Warn("skipping out-of-service taint, it's not supported by the cluster")
+		return true, nil
+	}
+
+	ctx, cancel := g.retryContext(ctx, notice)
+	defer cancel()
+
+	node, err := g.getNode(ctx)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			g.log.Info("node already removed, skipping out-of-service taint")
+			return true, nil
+		}
+		return false, err
+	}
+	if isNodeReady(node) {
+		g.log.Debugf("node is still ready after interruption at %s, waiting for shutdown before out-of-service taint", notice.Time)
+		return false, nil
+	}
+
+	g.log.Infof("tainting node out-of-service after interruption at %s", notice.Time)
+	if err := g.taintOutOfService(ctx, node); err != nil {
+		return false, err
+	}
+	g.recordNodeEvent(node, v1.EventTypeNormal, eventReasonOutOfService, "Node tainted %s after interruption at %s", taintOutOfService, notice.Time.Format(time.RFC3339))
+	return true, nil
+}
+
+// removeOutOfService removes the out-of-service taint from a node which survived the interruption, e.g. a stopped
+// instance started again.
+func (g *SpotHandler) removeOutOfService(ctx context.Context) error {
+	ctx, cancel := g.retryContext(ctx, nil)
+	defer cancel()
+
+	node, err := g.getNode(ctx)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	if len(filterTaints(node.Spec.Taints, []v1.Taint{outOfServiceTaint()})) == len(node.Spec.Taints) {
+		return nil
+	}
+	if g.isDryRun() {
+		g.log.Infof("dry-run: would remove %s taint from node %s", taintOutOfService, node.Name)
+		metrics.DryRunAction(operationApplyNode)
+		return nil
+	}
+
+	g.log.Info("interruption completed and node is still present, removing out-of-service taint")
+	if err := g.removeTaints(ctx, node, outOfServiceTaint()); err != nil {
+		return err
+	}
+	g.recordNodeEvent(node, v1.EventTypeNormal, eventReasonOutOfServiceRemoved, "Node survived interruption, %s taint removed", taintOutOfService)
+	return nil
+}
+
+func (g *SpotHandler) taintOutOfService(ctx context.Context, node *v1.Node) error {
+	if g.isDryRun() {
+		g.log.Infof("dry-run: would taint node %s with %s=%s:%s", node.Name, taintOutOfService, taintOutOfServiceValue, taintOutOfServiceEffect)
+		metrics.DryRunAction(operationApplyNode)
+		return nil
+	}
+
+	if err := g.addTaints(ctx, node, drainingTaint(), outOfServiceTaint()); err != nil {
+		return err
+	}
+	return g.applyNode(ctx, drainingNode(node.Name))
+}
+
+func isNodeReady(node *v1.Node) bool {
+	for _, c := range node.Status.Conditions {
+		if c.Type == v1.NodeReady {
+			return c.Status == v1.ConditionTrue
+		}
+	}
+	return false
+}
@@ -0,0 +1,114 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	ktest "k8s.io/client-go/testing"
+)
+
+type testVersion int
+
+func (v testVersion) Full() string {
+	return fmt.Sprintf("1.%d", v)
+}
+
+func (v testVersion) MinorInt() int {
+	return int(v)
+}
+
+func TestOutOfServiceTaint(t *testing.T) {
+	log := logrus.New()
+	nodeName := "AI"
+
+	hasOutOfServiceTaint := func(r *require.Assertions, fakeApi *fake.Clientset) bool {
+		got, err := fakeApi.CoreV1().Nodes().Get(context.Background(), nodeName, metav1.GetOptions{})
+		r.NoError(err)
+		for _, taint := range got.Spec.Taints {
+			if taint.Key == taintOutOfService {
+				return true
+			}
+		}
+		return false
+	}
+
+	newNode := func(ready v1.ConditionStatus) *v1.Node {
+		return &v1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: nodeName},
+			Status:     v1.NodeStatus{Conditions: []v1.NodeCondition{{Type: v1.NodeReady, Status: ready}}},
+		}
+	}
+
+	run := func(r *require.Assertions, k8sVersion testVersion, node *v1.Node, notices ...*InterruptNotice) *fake.Clientset {
+		fakeApi := fake.NewSimpleClientset(node)
+		handler := SpotHandler{
+			pollWaitInterval:  100 * time.Millisecond,
+			metadataChecker:   &mockNoticeChecker{notices: notices},
+			nodeName:          nodeName,
+			clientset:         fakeApi,
+			log:               log,
+			phase2Permissions: true,
+			outOfServiceTaint: true,
+			k8sVersion:        k8sVersion,
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+		defer cancel()
+		r.NoError(handler.Run(ctx))
+		return fakeApi
+	}
+	passed := &InterruptNotice{Status: NoticeStatusStarted, Time: time.Now().Add(-time.Second)}
+
+	t.Run("taint node shut down after interruption", func(t *testing.T) {
+		r := require.New(t)
+		fakeApi := run(r, 26, newNode(v1.ConditionUnknown), passed)
+		r.True(hasOutOfServiceTaint(r, fakeApi))
+	})
+
+	t.Run("do not taint node which is still ready", func(t *testing.T) {
+		r := require.New(t)
+		fakeApi := run(r, 26, newNode(v1.ConditionTrue), passed)
+		r.False(hasOutOfServiceTaint(r, fakeApi))
+	})
+
+	t.Run("do not taint node before interruption", func(t *testing.T) {
+		r := require.New(t)
+		fakeApi := run(r, 26, newNode(v1.ConditionUnknown), &InterruptNotice{Status: NoticeStatusScheduled, Time: time.Now().Add(time.Minute)})
+		r.False(hasOutOfServiceTaint(r, fakeApi))
+	})
+
+	t.Run("do not taint node on unsupported kubernetes version", func(t *testing.T) {
+		r := require.New(t)
+		fakeApi := run(r, 25, newNode(v1.ConditionUnknown), passed)
+		r.False(hasOutOfServiceTaint(r, fakeApi))
+	})
+
+	t.Run("remove taint when node survives interruption", func(t *testing.T) {
+		r := require.New(t)
+		completed := *passed
+		completed.Status = NoticeStatusCompleted
+		node := newNode(v1.ConditionUnknown)
+		node.Spec.Taints = []v1.Taint{{Key: "foreign", Effect: v1.TaintEffectNoSchedule}}
+		fakeApi := run(r, 26, node, passed, passed, &completed)
+		r.False(hasOutOfServiceTaint(r, fakeApi))
+
+		got, err := fakeApi.CoreV1().Nodes().Get(context.Background(), nodeName, metav1.GetOptions{})
+		r.NoError(err)
+		r.Contains(got.Spec.Taints, v1.Taint{Key: "foreign", Effect: v1.TaintEffectNoSchedule})
+		var patched int
+		for _, action := range fakeApi.Actions() {
+			if action.GetVerb() == "patch" && strings.Contains(string(action.(ktest.PatchAction).GetPatch()), taintOutOfService) {
+				patched++
+			}
+		}
+		r.Equal(1, patched)
+	})
+}
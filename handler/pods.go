@@ -0,0 +1,133 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/types"
+	corev1ac "k8s.io/client-go/applyconfigurations/core/v1"
+
+	"github.com/castai/spot-handler/metrics"
+)
+
+const (
+	// AnnotationInterrupted is set on pods of the interrupted node, so that applications reading annotations using
+	// the Downward API are able to start checkpointing before eviction.
+	AnnotationInterrupted = "spot-handler.cast.ai/interrupted"
+	// AnnotationTerminationTime is the RFC3339 time of the interruption, set only if reported by the provider.
+	AnnotationTerminationTime = "spot-handler.cast.ai/termination-time"
+
+	// podAnnotationTimeout bounds annotating pods, which is best effort and mustn't delay other actions.
+	podAnnotationTimeout = 15 * time.Second
+)
+
+// podAnnotationState makes background annotations run one at a time with the latest notice.
+type podAnnotationState struct {
+	mu      sync.Mutex
+	pending atomic.Pointer[InterruptNotice]
+}
+
+// annotatePodsAsync annotates pods off the poll loop and concurrently with hooks and drain. If annotations are
+// still running, pods are annotated with the latest notice once they finish.
+func (g *SpotHandler) annotatePodsAsync(ctx context.Context, state *pollState, notice *InterruptNotice) {
+	state.podAnnotations.pending.Store(notice)
+	state.localActions.Add(1)
+	go func() {
+		defer state.localActions.Done()
+		state.podAnnotations.mu.Lock()
+		defer state.podAnnotations.mu.Unlock()
+		if n := state.podAnnotations.pending.Swap(nil); n != nil {
+			g.annotatePods(ctx, n)
+		}
+	}()
+}
+
+// annotatePods annotates all pods on the node with interruption details. Failures are logged and don't stop
+// annotating other pods.
+func (g *SpotHandler) annotatePods(ctx context.Context, notice *InterruptNotice) {
+	if !g.podAnnotations {
+		return
+	}
+	annotations := podAnnotations(notice)
+	if g.isDryRun() {
+		g.log.Infof("dry-run: would annotate pods on node %s with %v", g.nodeName, annotations)
+		metrics.DryRunAction(operationApplyPod)
+		return
+	}
+
+	ctx, cancel := g.retryContext(ctx, notice)
+	defer cancel()
+	ctx, cancelAnnotation := context.WithTimeout(ctx, podAnnotationTimeout)
+	defer cancelAnnotation()
+
+	pods, err := g.listNodePods(ctx)
+	if err != nil {
+		g.log.Errorf("listing pods to annotate: %v", err)
+		return
+	}
+
+	annotated := 0
+	for i := range pods {
+		pod := &pods[i]
+		err := g.retry(ctx, operationApplyPod, func() error {
+			cfg := corev1ac.Pod(pod.Name, pod.Namespace).WithAnnotations(annotations)
+			err := g.applyOrPatch(cfg, func() error {
+				_, err := g.clientset.CoreV1().Pods(pod.Namespace).Apply(ctx, cfg, metav1.ApplyOptions{FieldManager: fieldManager, Force: true})
+				return err
+			}, func(data []byte) error {
+				_, err := g.clientset.CoreV1().Pods(pod.Namespace).Patch(ctx, pod.Name, types.StrategicMergePatchType, data, metav1.PatchOptions{FieldManager: fieldManager})
+				return err
+			})
+			if apierrors.IsNotFound(err) {
+				// Pod is gone already, there is nothing to notify.
+				return nil
+			}
+			return err
+		})
+		if err != nil {
+			g.log.Errorf("annotating pod %s/%s: %v", pod.Namespace, pod.Name, err)
+			continue
+		}
+		annotated++
+	}
+	g.log.Infof("annotated %d/%d pods with interruption notice", annotated, len(pods))
+}
+
+// listNodePods returns pods on the node which are not terminated yet.
+func (g *SpotHandler) listNodePods(ctx context.Context) ([]v1.Pod, error) {
+	var list *v1.PodList
+	err := g.retry(ctx, operationListPods, func() error {
+		var err error
+		list, err = g.clientset.CoreV1().Pods(metav1.NamespaceAll).List(ctx, metav1.ListOptions{
+			FieldSelector: fields.OneTermEqualSelector("spec.nodeName", g.nodeName).String(),
+		})
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing pods: %w", err)
+	}
+
+	pods := make([]v1.Pod, 0, len(list.Items))
+	for _, pod := range list.Items {
+		if pod.Spec.NodeName != g.nodeName || pod.Status.Phase == v1.PodSucceeded || pod.Status.Phase == v1.PodFailed {
+			continue
+		}
+		pods = append(pods, pod)
+	}
+	return pods, nil
+}
+
+func podAnnotations(notice *InterruptNotice) map[string]string {
+	annotations := map[string]string{AnnotationInterrupted: valueTrue}
+	if notice != nil && !notice.Time.IsZero() {
+		annotations[AnnotationTerminationTime] = notice.Time.UTC().Format(time.RFC3339)
+	}
+	return annotations
+}
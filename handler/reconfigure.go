@@ -0,0 +1,62 @@
+package handler
+
+import (
+	"time"
+
+	"github.com/castai/spot-handler/notifier"
+)
+
+// RuntimeConfig holds settings which can be changed while the handler is running.
+type RuntimeConfig struct {
+	PollInterval time.Duration
+	DryRun       bool
+	Notifiers    []notifier.Notifier
+}
+
+// Reconfigure applies settings to the running handler.
+func (g *SpotHandler) Reconfigure(cfg RuntimeConfig) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if cfg.PollInterval > 0 {
+		g.pollWaitInterval = cfg.PollInterval
+	}
+	g.dryRun = cfg.DryRun
+	g.notifiers = cfg.Notifiers
+
+	if g.reconfigured != nil {
+		select {
+		case g.reconfigured <- struct{}{}:
+		default:
+			// Change is already pending.
+		}
+	}
+}
+
+// watchReconfigure returns channel signalled on Reconfigure calls.
+func (g *SpotHandler) watchReconfigure() <-chan struct{} {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.reconfigured == nil {
+		g.reconfigured = make(chan struct{}, 1)
+	}
+	return g.reconfigured
+}
+
+func (g *SpotHandler) pollInterval() time.Duration {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.pollWaitInterval
+}
+
+func (g *SpotHandler) isDryRun() bool {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.dryRun
+}
+
+func (g *SpotHandler) currentNotifiers() []notifier.Notifier {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.notifiers
+}
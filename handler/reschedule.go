@@ -0,0 +1,228 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	appsv1ac "k8s.io/client-go/applyconfigurations/apps/v1"
+	corev1ac "k8s.io/client-go/applyconfigurations/core/v1"
+	"k8s.io/utils/ptr"
+)
+
+const (
+	DrainStrategyEvict = "evict"
+	// DrainStrategyRescheduleAware evicts pods of ReplicaSets and StatefulSets only once their owner has enough
+	// ready replicas on other nodes. Deployments are restarted to create replacements before eviction. StatefulSets
+	// aren't restarted, as their replacement isn't created until the pod is gone, and pods of StatefulSets without
+	// more replicas than required ready are evicted right away.
+	DrainStrategyRescheduleAware = "reschedule-aware"
+
+	// annotationRestartedAt is the same annotation kubectl rollout restart sets on the pod template.
+	annotationRestartedAt = "kubectl.kubernetes.io/restartedAt"
+
+	defaultMinReadyReplicas = 1
+
+	replacementPollInterval = 500 * time.Millisecond
+)
+
+// rescheduler delays evictions until replacement pods are ready on other nodes. Deployments are restarted at most
+// once per drain.
+type rescheduler struct {
+	g                *SpotHandler
+	minReadyReplicas int
+
+	mu        sync.Mutex
+	restarted map[string]bool
+	// ready is shared by pods waiting for the same workload, so that its pods are listed once per poll interval.
+	ready map[string]*readyReplicas
+}
+
+// readyReplicas is the last count of ready replicas of a workload on other nodes.
+type readyReplicas struct {
+	mu      sync.Mutex
+	checked time.Time
+	count   int
+	err     error
+}
+
+func newRescheduler(g *SpotHandler, minReadyReplicas int) *rescheduler {
+	if minReadyReplicas <= 0 {
+		minReadyReplicas = defaultMinReadyReplicas
+	}
+	return &rescheduler{
+		g:                g,
+		minReadyReplicas: minReadyReplicas,
+		restarted:        map[string]bool{},
+		ready:            map[string]*readyReplicas{},
+	}
+}
+
+// workload is the top level owner of the pod, replacements of the pod are matched by its selector.
+type workload struct {
+	kind      string
+	name      string
+	namespace string
+	selector  labels.Selector
+}
+
+// waitForReplacement waits until the owner of the pod has enough ready replicas on other nodes. A quarter of the
+// time left is kept for the eviction itself, once it's reached the pod is evicted regardless.
+func (r *rescheduler) waitForReplacement(ctx context.Context, pod *v1.Pod) {
+	w, err := r.workload(ctx, pod)
+	if err != nil {
+		r.g.log.Warnf("getting owner of pod %s/%s, evicting without waiting for replacement: %v", pod.Namespace, pod.Name, err)
+		return
+	}
+	if w == nil {
+		return
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, deadline.Add(-time.Until(deadline)/4))
+		defer cancel()
+	}
+
+	err = wait.PollUntilContextCancel(ctx, replacementPollInterval, true, func(ctx context.Context) (bool, error) {
+		ready, err := r.readyElsewhere(ctx, w)
+		if err != nil {
+			// Transient errors are ignored until the wait is over.
+			return false, nil
+		}
+		if ready >= r.minReadyReplicas {
+			return true, nil
+		}
+		if w.kind == "Deployment" {
+			r.restart(ctx, w)
+		}
+		return false, nil
+	})
+	if err != nil {
+		r.g.log.Warnf("replacement of pod %s/%s not ready in time, evicting anyway", pod.Namespace, pod.Name)
+	}
+}
+
+func (r *rescheduler) workload(ctx context.Context, pod *v1.Pod) (*workload, error) {
+	owner := metav1.GetControllerOf(pod)
+	if owner == nil {
+		return nil, nil
+	}
+
+	apps := r.g.clientset.AppsV1()
+	switch owner.Kind {
+	case "StatefulSet":
+		sts, err := apps.StatefulSets(pod.Namespace).Get(ctx, owner.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		if ptr.Deref(sts.Spec.Replicas, 1) <= int32(r.minReadyReplicas) {
+			// Other replicas can't reach the minimum while this pod is running.
+			return nil, nil
+		}
+		return newWorkload("StatefulSet", sts.ObjectMeta, sts.Spec.Selector)
+	case "ReplicaSet":
+		rs, err := apps.ReplicaSets(pod.Namespace).Get(ctx, owner.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		if d := metav1.GetControllerOf(rs); d != nil && d.Kind == "Deployment" {
+			deploy, err := apps.Deployments(pod.Namespace).Get(ctx, d.Name, metav1.GetOptions{})
+			if err != nil {
+				return nil, err
+			}
+			return newWorkload("Deployment", deploy.ObjectMeta, deploy.Spec.Selector)
+		}
+		return newWorkload("ReplicaSet", rs.ObjectMeta, rs.Spec.Selector)
+	default:
+		return nil, nil
+	}
+}
+
+func newWorkload(kind string, meta metav1.ObjectMeta, selector *metav1.LabelSelector) (*workload, error) {
+	s, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		return nil, fmt.Errorf("parsing selector of %s %s/%s: %w", kind, meta.Namespace, meta.Name, err)
+	}
+	return &workload{kind: kind, name: meta.Name, namespace: meta.Namespace, selector: s}, nil
+}
+
+// readyElsewhere returns the number of ready replicas of the workload on other nodes. Pods are listed at most once
+// per poll interval for all pods waiting for the workload.
+func (r *rescheduler) readyElsewhere(ctx context.Context, w *workload) (int, error) {
+	key := w.kind + "/" + w.namespace + "/" + w.name
+	r.mu.Lock()
+	ready, ok := r.ready[key]
+	if !ok {
+		ready = &readyReplicas{}
+		r.ready[key] = ready
+	}
+	r.mu.Unlock()
+
+	ready.mu.Lock()
+	defer ready.mu.Unlock()
+	if time.Since(ready.checked) < replacementPollInterval {
+		return ready.count, ready.err
+	}
+
+	pods, err := r.g.clientset.CoreV1().Pods(w.namespace).List(ctx, metav1.ListOptions{LabelSelector: w.selector.String()})
+	ready.checked, ready.count, ready.err = time.Now(), 0, err
+	if err != nil {
+		return 0, err
+	}
+	for _, p := range pods.Items {
+		if p.Spec.NodeName != r.g.nodeName && p.DeletionTimestamp == nil && isPodReady(&p) {
+			ready.count++
+		}
+	}
+	return ready.count, nil
+}
+
+// restart triggers a rollout restart of the deployment, so that replacements are created on other nodes while the
+// pods on this node keep serving.
+func (r *rescheduler) restart(ctx context.Context, w *workload) {
+	key := w.namespace + "/" + w.name
+	r.mu.Lock()
+	if r.restarted[key] {
+		r.mu.Unlock()
+		return
+	}
+	r.restarted[key] = true
+	r.mu.Unlock()
+
+	cfg := appsv1ac.Deployment(w.name, w.namespace).
+		WithSpec(appsv1ac.DeploymentSpec().
+			WithTemplate(corev1ac.PodTemplateSpec().
+				WithAnnotations(map[string]string{annotationRestartedAt: time.Now().UTC().Format(time.RFC3339)}),
+			),
+		)
+	err := r.g.retry(ctx, operationRestartDeployment, func() error {
+		return r.g.applyOrPatch(cfg, func() error {
+			_, err := r.g.clientset.AppsV1().Deployments(w.namespace).Apply(ctx, cfg, metav1.ApplyOptions{FieldManager: fieldManager, Force: true})
+			return err
+		}, func(data []byte) error {
+			_, err := r.g.clientset.AppsV1().Deployments(w.namespace).Patch(ctx, w.name, types.StrategicMergePatchType, data, metav1.PatchOptions{FieldManager: fieldManager})
+			return err
+		})
+	})
+	if err != nil {
+		r.g.log.Errorf("restarting deployment %s: %v", key, err)
+		return
+	}
+	r.g.log.Infof("restarted deployment %s to create replacement pods", key)
+}
+
+func isPodReady(pod *v1.Pod) bool {
+	for _, c := range pod.Status.Conditions {
+		if c.Type == v1.PodReady {
+			return c.Status == v1.ConditionTrue
+		}
+	}
+	return false
+}
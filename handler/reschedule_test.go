@@ -0,0 +1,261 @@
+package handler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	ktest "k8s.io/client-go/testing"
+	"k8s.io/utils/ptr"
+)
+
+func TestRescheduleAwareDrain(t *testing.T) {
+	log := logrus.New()
+	nodeName := "AI"
+	node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: nodeName}}
+	selector := &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}}
+
+	newWebPod := func(name, nodeName, ownerKind, ownerName string) *v1.Pod {
+		return &v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            name,
+				Namespace:       "default",
+				Labels:          map[string]string{"app": "web"},
+				OwnerReferences: []metav1.OwnerReference{{Kind: ownerKind, Name: ownerName, Controller: ptr.To(true)}},
+			},
+			Spec: v1.PodSpec{NodeName: nodeName},
+			Status: v1.PodStatus{
+				Phase:      v1.PodRunning,
+				Conditions: []v1.PodCondition{{Type: v1.PodReady, Status: v1.ConditionTrue}},
+			},
+		}
+	}
+
+	evictions := func(fakeApi *fake.Clientset, evicted chan<- time.Time) {
+		fakeApi.PrependReactor("create", "pods", func(action ktest.Action) (bool, runtime.Object, error) {
+			if action.GetSubresource() != "eviction" {
+				return false, nil, nil
+			}
+			eviction := action.(ktest.CreateAction).GetObject().(*policyv1.Eviction)
+			evicted <- time.Now()
+			return true, nil, fakeApi.Tracker().Delete(v1.SchemeGroupVersion.WithResource("pods"), eviction.Namespace, eviction.Name)
+		})
+	}
+
+	t.Run("restart deployment and evict once replacement is ready", func(t *testing.T) {
+		r := require.New(t)
+
+		deploy := &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+			Spec:       appsv1.DeploymentSpec{Selector: selector},
+		}
+		rs := &appsv1.ReplicaSet{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            "web-rs",
+				Namespace:       "default",
+				OwnerReferences: []metav1.OwnerReference{{Kind: "Deployment", Name: "web", Controller: ptr.To(true)}},
+			},
+			Spec: appsv1.ReplicaSetSpec{Selector: selector},
+		}
+		fakeApi := fake.NewSimpleClientset(node, deploy, rs, newWebPod("web-1", nodeName, "ReplicaSet", "web-rs"))
+		fakeApi.PrependReactor("patch", "deployments", func(action ktest.Action) (bool, runtime.Object, error) {
+			// Restarted deployment creates replacement on another node.
+			return false, nil, fakeApi.Tracker().Add(newWebPod("web-2", "other", "ReplicaSet", "web-rs-new"))
+		})
+		evicted := make(chan time.Time, 10)
+		evictions(fakeApi, evicted)
+
+		handler := SpotHandler{
+			clientset:         fakeApi,
+			nodeName:          nodeName,
+			log:               log,
+			phase2Permissions: true,
+			drain:             DrainConfig{Enabled: true, Strategy: DrainStrategyRescheduleAware},
+		}
+		handler.drainNode(context.Background(), &InterruptNotice{Time: time.Now().Add(time.Minute)})
+
+		r.Len(evicted, 1)
+		got, err := fakeApi.AppsV1().Deployments("default").Get(context.Background(), "web", metav1.GetOptions{})
+		r.NoError(err)
+		r.Contains(got.Spec.Template.Annotations, annotationRestartedAt)
+		_, err = fakeApi.CoreV1().Pods("default").Get(context.Background(), "web-2", metav1.GetOptions{})
+		r.NoError(err)
+	})
+
+	t.Run("evict without replacement when time runs out", func(t *testing.T) {
+		r := require.New(t)
+
+		rs := &appsv1.ReplicaSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+			Spec:       appsv1.ReplicaSetSpec{Selector: selector},
+		}
+		fakeApi := fake.NewSimpleClientset(node, rs, newWebPod("web-0", nodeName, "ReplicaSet", "web"))
+		evicted := make(chan time.Time, 10)
+		evictions(fakeApi, evicted)
+
+		handler := SpotHandler{
+			clientset:         fakeApi,
+			nodeName:          nodeName,
+			log:               log,
+			phase2Permissions: true,
+			drain:             DrainConfig{Enabled: true, Strategy: DrainStrategyRescheduleAware},
+		}
+		start := time.Now()
+		handler.drainNode(context.Background(), &InterruptNotice{Time: time.Now().Add(2 * time.Second)})
+
+		r.Len(evicted, 1)
+		r.WithinRange(<-evicted, start.Add(time.Second), start.Add(2*time.Second))
+	})
+
+	t.Run("evict other pods while waiting for replacement", func(t *testing.T) {
+		r := require.New(t)
+
+		rs := &appsv1.ReplicaSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+			Spec:       appsv1.ReplicaSetSpec{Selector: selector},
+		}
+		standalone := newWebPod("standalone", nodeName, "", "")
+		standalone.OwnerReferences = nil
+		standalone.Labels = nil
+		// Planned after the pod waiting for replacement.
+		standalone.Spec.Priority = ptr.To[int32](1)
+		fakeApi := fake.NewSimpleClientset(node, rs, newWebPod("web-0", nodeName, "ReplicaSet", "web"), standalone)
+		evicted := make(chan time.Time, 10)
+		evictions(fakeApi, evicted)
+
+		handler := SpotHandler{
+			clientset:         fakeApi,
+			nodeName:          nodeName,
+			log:               log,
+			phase2Permissions: true,
+			drain:             DrainConfig{Enabled: true, Strategy: DrainStrategyRescheduleAware, Concurrency: 1},
+		}
+		start := time.Now()
+		handler.drainNode(context.Background(), &InterruptNotice{Time: time.Now().Add(2 * time.Second)})
+
+		r.Len(evicted, 2)
+		r.Less((<-evicted).Sub(start), time.Second)
+	})
+
+	t.Run("evict statefulset pods once ready elsewhere", func(t *testing.T) {
+		r := require.New(t)
+
+		sts := &appsv1.StatefulSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+			Spec:       appsv1.StatefulSetSpec{Selector: selector, Replicas: ptr.To[int32](2)},
+		}
+		fakeApi := fake.NewSimpleClientset(node, sts, newWebPod("web-0", nodeName, "StatefulSet", "web"))
+		time.AfterFunc(time.Second, func() {
+			_ = fakeApi.Tracker().Add(newWebPod("web-1", "other", "StatefulSet", "web"))
+		})
+		evicted := make(chan time.Time, 10)
+		evictions(fakeApi, evicted)
+
+		handler := SpotHandler{
+			clientset:         fakeApi,
+			nodeName:          nodeName,
+			log:               log,
+			phase2Permissions: true,
+			drain:             DrainConfig{Enabled: true, Strategy: DrainStrategyRescheduleAware},
+		}
+		start := time.Now()
+		handler.drainNode(context.Background(), &InterruptNotice{Time: time.Now().Add(time.Minute)})
+
+		r.Len(evicted, 1)
+		r.WithinRange(<-evicted, start.Add(time.Second), start.Add(3*time.Second))
+		for _, action := range fakeApi.Actions() {
+			r.False(action.GetVerb() == "patch" && action.GetResource().Resource == "statefulsets")
+		}
+	})
+
+	t.Run("evict pods of statefulset with too few replicas without waiting", func(t *testing.T) {
+		r := require.New(t)
+
+		sts := &appsv1.StatefulSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+			Spec:       appsv1.StatefulSetSpec{Selector: selector, Replicas: ptr.To[int32](1)},
+		}
+		fakeApi := fake.NewSimpleClientset(node, sts, newWebPod("web-0", nodeName, "StatefulSet", "web"))
+		evicted := make(chan time.Time, 10)
+		evictions(fakeApi, evicted)
+
+		handler := SpotHandler{
+			clientset:         fakeApi,
+			nodeName:          nodeName,
+			log:               log,
+			phase2Permissions: true,
+			drain:             DrainConfig{Enabled: true, Strategy: DrainStrategyRescheduleAware},
+		}
+		start := time.Now()
+		handler.drainNode(context.Background(), &InterruptNotice{Time: time.Now().Add(time.Minute)})
+
+		r.Len(evicted, 1)
+		r.Less(time.Since(start), time.Second)
+	})
+
+	t.Run("list pods of workload once per poll for all waiting pods", func(t *testing.T) {
+		r := require.New(t)
+
+		rs := &appsv1.ReplicaSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+			Spec:       appsv1.ReplicaSetSpec{Selector: selector},
+		}
+		fakeApi := fake.NewSimpleClientset(node, rs,
+			newWebPod("web-0", nodeName, "ReplicaSet", "web"),
+			newWebPod("web-1", nodeName, "ReplicaSet", "web"),
+			newWebPod("web-2", nodeName, "ReplicaSet", "web"),
+		)
+		evicted := make(chan time.Time, 10)
+		evictions(fakeApi, evicted)
+
+		handler := SpotHandler{
+			clientset:         fakeApi,
+			nodeName:          nodeName,
+			log:               log,
+			phase2Permissions: true,
+			drain:             DrainConfig{Enabled: true, Strategy: DrainStrategyRescheduleAware},
+		}
+		handler.drainNode(context.Background(), &InterruptNotice{Time: time.Now().Add(2 * time.Second)})
+
+		r.Len(evicted, 3)
+		lists := 0
+		for _, action := range fakeApi.Actions() {
+			if list, ok := action.(ktest.ListAction); ok && !list.GetListRestrictions().Labels.Empty() {
+				lists++
+			}
+		}
+		// Waiting takes about 1.5s, polled every 500ms.
+		r.LessOrEqual(lists, 5)
+	})
+
+	t.Run("evict pods without owner immediately", func(t *testing.T) {
+		r := require.New(t)
+
+		pod := newWebPod("standalone", nodeName, "", "")
+		pod.OwnerReferences = nil
+		fakeApi := fake.NewSimpleClientset(node, pod)
+		evicted := make(chan time.Time, 10)
+		evictions(fakeApi, evicted)
+
+		handler := SpotHandler{
+			clientset:         fakeApi,
+			nodeName:          nodeName,
+			log:               log,
+			phase2Permissions: true,
+			drain:             DrainConfig{Enabled: true, Strategy: DrainStrategyRescheduleAware},
+		}
+		start := time.Now()
+		handler.drainNode(context.Background(), &InterruptNotice{Time: time.Now().Add(time.Minute)})
+
+		r.Len(evicted, 1)
+		r.Less(time.Since(start), time.Second)
+	})
+}
@@ -0,0 +1,105 @@
+package handler
+
+import (
+	"context"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+
+	"github.com/castai/spot-handler/metrics"
+)
+
+const (
+	operationGetNode                = "get_node"
+	operationApplyNode              = "apply_node"
+	operationListPods               = "list_pods"
+	operationApplyPod               = "apply_pod"
+	operationEvictPod               = "evict_pod"
+	operationDeleteVolumeAttachment = "delete_volume_attachment"
+	// operationRestartDeployment creates replacements of pods before eviction.
+	operationRestartDeployment = "restart_deployment"
+	operationSendCloudEvent    = "send_cloud_event"
+	operationSendHeartbeat     = "send_heartbeat"
+	// operationNotify is prefixed to the notifier name.
+	operationNotify = "notify_"
+)
+
+// minRetryBudget is the retry budget once the termination time reported by the notice has passed, the node may
+// still be shutting down.
+const minRetryBudget = 5 * time.Second
+
+// RetryConfig configures retries of node lookups, node updates and mothership calls.
+type RetryConfig struct {
+	InitialInterval time.Duration
+	MaxInterval     time.Duration
+	// MaxElapsedTime bounds retries when the interruption notice doesn't report termination time, otherwise they're
+	// bounded by the termination time. Retries within a single poll are bounded by the poll interval as well, mothership
+	// events are then resent on the following polls until this budget is spent.
+	MaxElapsedTime time.Duration
+}
+
+func DefaultRetryConfig() RetryConfig {
+	return RetryConfig{
+		InitialInterval: 500 * time.Millisecond,
+		MaxInterval:     5 * time.Second,
+		MaxElapsedTime:  time.Minute,
+	}
+}
+
+func (c RetryConfig) withDefaults() RetryConfig {
+	def := DefaultRetryConfig()
+	if c.InitialInterval <= 0 {
+		c.InitialInterval = def.InitialInterval
+	}
+	if c.MaxInterval <= 0 {
+		c.MaxInterval = def.MaxInterval
+	}
+	if c.MaxElapsedTime <= 0 {
+		c.MaxElapsedTime = def.MaxElapsedTime
+	}
+	return c
+}
+
+// retryContext returns context bounding retries of the notice handling started now.
+func (g *SpotHandler) retryContext(ctx context.Context, notice *InterruptNotice) (context.Context, context.CancelFunc) {
+	return context.WithDeadline(ctx, g.retryDeadline(time.Now(), notice))
+}
+
+// retryDeadline returns when retries of the notice handling started at start are given up. There is no point in
+// retrying after the instance is gone, so the deadline is the notice termination time when it's known, or shortly
+// after start if it has already passed.
+func (g *SpotHandler) retryDeadline(start time.Time, notice *InterruptNotice) time.Time {
+	if notice != nil && !notice.Time.IsZero() {
+		return maxTime(notice.Time, start.Add(minRetryBudget))
+	}
+	return start.Add(g.retryConfig.withDefaults().MaxElapsedTime)
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+// retry runs op with exponential backoff and jitter until it succeeds, returns a backoff.Permanent error or ctx
+// is done.
+func (g *SpotHandler) retry(ctx context.Context, operation string, op func() error) error {
+	cfg := g.retryConfig.withDefaults()
+
+	b := backoff.NewExponentialBackOff()
+	b.InitialInterval = cfg.InitialInterval
+	b.MaxInterval = cfg.MaxInterval
+	// Retries are bounded by the context.
+	b.MaxElapsedTime = 0
+
+	err := backoff.RetryNotify(op, backoff.WithContext(b, ctx), func(err error, next time.Duration) {
+		metrics.OperationRetried(operation)
+		g.log.Warnf("%s failed, retrying in %s: %v", operation, next, err)
+	})
+	if err != nil {
+		metrics.OperationFailed(operation)
+		return err
+	}
+	return nil
+}
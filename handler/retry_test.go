@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetry(t *testing.T) {
+	log := logrus.New()
+
+	t.Run("retry until operation succeeds", func(t *testing.T) {
+		r := require.New(t)
+		handler := SpotHandler{
+			log:         log,
+			retryConfig: RetryConfig{InitialInterval: time.Millisecond, MaxInterval: 5 * time.Millisecond},
+		}
+
+		calls := 0
+		err := handler.retry(context.Background(), "test", func() error {
+			calls++
+			if calls < 3 {
+				return errors.New("failed")
+			}
+			return nil
+		})
+		r.NoError(err)
+		r.Equal(3, calls)
+	})
+
+	t.Run("stop retrying when context is done", func(t *testing.T) {
+		r := require.New(t)
+		handler := SpotHandler{
+			log:         log,
+			retryConfig: RetryConfig{InitialInterval: time.Millisecond, MaxInterval: 5 * time.Millisecond},
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		err := handler.retry(ctx, "test", func() error {
+			return errors.New("failed")
+		})
+		r.Error(err)
+	})
+
+	t.Run("bound retries by notice termination time", func(t *testing.T) {
+		r := require.New(t)
+		handler := SpotHandler{
+			log:         log,
+			retryConfig: RetryConfig{MaxElapsedTime: time.Hour},
+		}
+
+		ctx, cancel := handler.retryContext(context.Background(), &InterruptNotice{Time: time.Now().Add(2 * time.Minute)})
+		defer cancel()
+		deadline, ok := ctx.Deadline()
+		r.True(ok)
+		r.WithinDuration(time.Now().Add(2*time.Minute), deadline, time.Second)
+
+		ctx, cancel = handler.retryContext(context.Background(), &InterruptNotice{})
+		defer cancel()
+		deadline, ok = ctx.Deadline()
+		r.True(ok)
+		r.WithinDuration(time.Now().Add(time.Hour), deadline, time.Second)
+
+		ctx, cancel = handler.retryContext(context.Background(), &InterruptNotice{Time: time.Now().Add(-time.Minute)})
+		defer cancel()
+		deadline, ok = ctx.Deadline()
+		r.True(ok)
+		r.WithinDuration(time.Now().Add(minRetryBudget), deadline, time.Second)
+	})
+}
@@ -0,0 +1,191 @@
+package handler
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	SimulateInterrupted = "interrupted"
+	SimulateRebalance   = "rebalance"
+	SimulateMaintenance = "maintenance"
+	// SimulateComplete reports the injected interruption or maintenance as completed.
+	SimulateComplete = "complete"
+	// SimulateClear removes injected notices.
+	SimulateClear = "clear"
+
+	// simulatedNoticeLeadTime is the time until the simulated interruption, similar to the AWS spot notice.
+	simulatedNoticeLeadTime = 2 * time.Minute
+	// simulatedMaintenanceLeadTime is the time until the simulated maintenance, similar to Azure scheduled events.
+	simulatedMaintenanceLeadTime = 15 * time.Minute
+)
+
+// SimulateRequest is the body of the simulation endpoint request.
+type SimulateRequest struct {
+	Type string `json:"type"`
+}
+
+// simulatedNotice returns a synthetic interruption notice of the given type, nil notice is returned for
+// rebalance recommendation. Spot interruption is already under way, while maintenance is scheduled ahead.
+func simulatedNotice(noticeType string) (*InterruptNotice, error) {
+	switch noticeType {
+	case SimulateInterrupted:
+		return &InterruptNotice{
+			Action:    "simulated-" + noticeType,
+			Status:    NoticeStatusStarted,
+			Time:      time.Now().Add(simulatedNoticeLeadTime),
+			Simulated: true,
+		}, nil
+	case SimulateMaintenance:
+		return &InterruptNotice{
+			Action:    "simulated-" + noticeType,
+			Status:    NoticeStatusScheduled,
+			Time:      time.Now().Add(simulatedMaintenanceLeadTime),
+			Simulated: true,
+		}, nil
+	case SimulateRebalance:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown notice type %q, expected one of: %s, %s, %s", noticeType, SimulateInterrupted, SimulateRebalance, SimulateMaintenance)
+	}
+}
+
+// Simulate handles a synthetic notice of the given type the same way a real one is handled.
+func (g *SpotHandler) Simulate(ctx context.Context, noticeType string) error {
+	if noticeType == SimulateComplete || noticeType == SimulateClear {
+		return fmt.Errorf("notice type %q is supported only when injecting into a running handler", noticeType)
+	}
+	notice, err := simulatedNotice(noticeType)
+	if err != nil {
+		return err
+	}
+
+	if notice == nil {
+		return g.handleRebalanceRecommendation(ctx, nil)
+	}
+	if err := g.handleInterruption(ctx, notice, nil); err != nil {
+		return err
+	}
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		g.annotatePods(ctx, notice)
+	}()
+	go func() {
+		defer wg.Done()
+		g.runHooks(ctx, notice)
+	}()
+	g.drainNode(ctx, notice)
+	wg.Wait()
+	return nil
+}
+
+// NoticeInjector wraps the metadata checker of a running handler and reports injected synthetic notices on top of
+// the real ones. It serves the authenticated simulation endpoint.
+type NoticeInjector struct {
+	MetadataChecker
+
+	token string
+
+	mu        sync.Mutex
+	interrupt *InterruptNotice
+	rebalance bool
+}
+
+func NewNoticeInjector(checker MetadataChecker, token string) *NoticeInjector {
+	return &NoticeInjector{
+		MetadataChecker: checker,
+		token:           token,
+	}
+}
+
+// Inject makes the notice of the given type visible to the handler on its next poll. Injected interruption stays
+// until it's completed or cleared.
+func (i *NoticeInjector) Inject(noticeType string) error {
+	switch noticeType {
+	case SimulateComplete:
+		i.mu.Lock()
+		defer i.mu.Unlock()
+		if i.interrupt == nil {
+			return fmt.Errorf("no injected interruption to complete")
+		}
+		completed := *i.interrupt
+		completed.Status = NoticeStatusCompleted
+		i.interrupt = &completed
+		return nil
+	case SimulateClear:
+		i.mu.Lock()
+		defer i.mu.Unlock()
+		i.interrupt = nil
+		i.rebalance = false
+		return nil
+	}
+
+	notice, err := simulatedNotice(noticeType)
+	if err != nil {
+		return err
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if notice == nil {
+		i.rebalance = true
+	} else {
+		i.interrupt = notice
+	}
+	return nil
+}
+
+func (i *NoticeInjector) CheckInterrupt(ctx context.Context) (bool, error) {
+	notice, err := i.GetInterruptNotice(ctx)
+	return notice != nil, err
+}
+
+func (i *NoticeInjector) GetInterruptNotice(ctx context.Context) (*InterruptNotice, error) {
+	i.mu.Lock()
+	injected := i.interrupt
+	i.mu.Unlock()
+	if injected != nil {
+		return injected, nil
+	}
+
+	return getInterruptNotice(ctx, i.MetadataChecker)
+}
+
+func (i *NoticeInjector) CheckRebalanceRecommendation(ctx context.Context) (bool, error) {
+	i.mu.Lock()
+	injected := i.rebalance
+	i.mu.Unlock()
+	if injected {
+		return true, nil
+	}
+	return i.MetadataChecker.CheckRebalanceRecommendation(ctx)
+}
+
+func (i *NoticeInjector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if i.token == "" || subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+i.token)) != 1 {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req SimulateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("decoding request: %v", err), http.StatusBadRequest)
+		return
+	}
+	if err := i.Inject(req.Type); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
@@ -0,0 +1,193 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/castai/spot-handler/castai"
+)
+
+func TestNoticeInjector(t *testing.T) {
+	t.Run("reject unauthenticated requests", func(t *testing.T) {
+		r := require.New(t)
+		injector := NewNoticeInjector(&mockInterruptChecker{}, "secret")
+
+		req := httptest.NewRequest(http.MethodPost, "/simulate", strings.NewReader(`{"type":"interrupted"}`))
+		req.Header.Set("Authorization", "Bearer wrong")
+		rec := httptest.NewRecorder()
+		injector.ServeHTTP(rec, req)
+		r.Equal(http.StatusUnauthorized, rec.Code)
+
+		interrupted, err := injector.CheckInterrupt(context.Background())
+		r.NoError(err)
+		r.False(interrupted)
+	})
+
+	t.Run("inject interruption and rebalance notices", func(t *testing.T) {
+		r := require.New(t)
+		injector := NewNoticeInjector(&mockInterruptChecker{}, "secret")
+
+		for _, noticeType := range []string{SimulateInterrupted, SimulateRebalance} {
+			req := httptest.NewRequest(http.MethodPost, "/simulate", strings.NewReader(`{"type":"`+noticeType+`"}`))
+			req.Header.Set("Authorization", "Bearer secret")
+			rec := httptest.NewRecorder()
+			injector.ServeHTTP(rec, req)
+			r.Equal(http.StatusAccepted, rec.Code)
+		}
+
+		notice, err := injector.GetInterruptNotice(context.Background())
+		r.NoError(err)
+		r.NotNil(notice)
+		r.False(notice.Time.IsZero())
+
+		rebalance, err := injector.CheckRebalanceRecommendation(context.Background())
+		r.NoError(err)
+		r.True(rebalance)
+	})
+
+	t.Run("complete and clear injected notices", func(t *testing.T) {
+		r := require.New(t)
+		injector := NewNoticeInjector(&mockInterruptChecker{}, "secret")
+		r.Error(injector.Inject(SimulateComplete))
+
+		r.NoError(injector.Inject(SimulateMaintenance))
+		r.NoError(injector.Inject(SimulateRebalance))
+		notice, err := injector.GetInterruptNotice(context.Background())
+		r.NoError(err)
+		r.Equal(NoticeStatusScheduled, notice.Status)
+
+		r.NoError(injector.Inject(SimulateComplete))
+		completed, err := injector.GetInterruptNotice(context.Background())
+		r.NoError(err)
+		r.Equal(NoticeStatusCompleted, completed.Status)
+		r.Equal(notice.Time, completed.Time)
+
+		r.NoError(injector.Inject(SimulateClear))
+		notice, err = injector.GetInterruptNotice(context.Background())
+		r.NoError(err)
+		r.Nil(notice)
+		rebalance, err := injector.CheckRebalanceRecommendation(context.Background())
+		r.NoError(err)
+		r.False(rebalance)
+	})
+
+	t.Run("simulate maintenance ahead of interruption", func(t *testing.T) {
+		r := require.New(t)
+
+		interrupted, err := simulatedNotice(SimulateInterrupted)
+		r.NoError(err)
+		maintenance, err := simulatedNotice(SimulateMaintenance)
+		r.NoError(err)
+		r.Equal(NoticeStatusStarted, interrupted.Status)
+		r.Equal(NoticeStatusScheduled, maintenance.Status)
+		r.True(maintenance.Time.After(interrupted.Time))
+	})
+
+	t.Run("reject unknown notice type", func(t *testing.T) {
+		r := require.New(t)
+		injector := NewNoticeInjector(&mockInterruptChecker{}, "secret")
+		r.Error(injector.Inject("unknown"))
+	})
+}
+
+func TestSimulate(t *testing.T) {
+	r := require.New(t)
+	log := logrus.New()
+
+	nodeName := "AI"
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: nodeName,
+			Labels: map[string]string{
+				CastNodeIDLabel: "CAST",
+			},
+		},
+	}
+
+	mothershipCalls := 0
+	castS := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, re *http.Request) {
+		mothershipCalls++
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer castS.Close()
+
+	fakeApi := fake.NewSimpleClientset(node)
+	castHttp, err := castai.NewRestyClient(castS.URL, "test", castai.TLSConfig{}, log.Level, 100*time.Millisecond, "0.0.0")
+	r.NoError(err)
+
+	handler := SpotHandler{
+		castClient:        castai.NewClient(log, castHttp, "test1", castai.BatchConfig{}),
+		nodeName:          nodeName,
+		clientset:         fakeApi,
+		log:               log,
+		phase2Permissions: true,
+	}
+
+	// Nothing is injected when simulating locally.
+	r.Error(handler.Simulate(context.Background(), SimulateComplete))
+	r.Error(handler.Simulate(context.Background(), SimulateClear))
+
+	handler.dryRun = true
+	r.NoError(handler.Simulate(context.Background(), SimulateInterrupted))
+	r.Equal(0, mothershipCalls)
+	got, err := fakeApi.CoreV1().Nodes().Get(context.Background(), nodeName, metav1.GetOptions{})
+	r.NoError(err)
+	r.False(got.Spec.Unschedulable)
+
+	handler.dryRun = false
+	r.NoError(handler.Simulate(context.Background(), SimulateInterrupted))
+	r.Equal(1, mothershipCalls)
+	got, err = fakeApi.CoreV1().Nodes().Get(context.Background(), nodeName, metav1.GetOptions{})
+	r.NoError(err)
+	r.True(got.Spec.Unschedulable)
+}
+
+func TestNoticeInjectorRealNoticeAfterSimulation(t *testing.T) {
+	nodeName := "AI"
+	real := &InterruptNotice{Action: "terminate", Status: NoticeStatusScheduled, Time: time.Now().Add(time.Minute)}
+
+	for _, end := range []string{SimulateClear, SimulateComplete} {
+		t.Run("handle real notice after "+end, func(t *testing.T) {
+			r := require.New(t)
+			checker := &mockNoticeChecker{notices: []*InterruptNotice{nil}}
+			injector := NewNoticeInjector(checker, "secret")
+			handler := SpotHandler{
+				metadataChecker: injector,
+				nodeName:        nodeName,
+				clientset:       fake.NewSimpleClientset(&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: nodeName}}),
+				log:             logrus.New(),
+			}
+			var state pollState
+			defer state.localActions.Wait()
+
+			r.NoError(injector.Inject(SimulateInterrupted))
+			r.NoError(handler.poll(context.Background(), &state))
+			r.True(state.interruption.Simulated)
+
+			r.NoError(injector.Inject(end))
+			r.NoError(handler.poll(context.Background(), &state))
+			r.NoError(injector.Inject(SimulateClear))
+			r.NoError(handler.poll(context.Background(), &state))
+			r.Nil(state.interruption)
+			r.False(state.interruptionCompleted)
+
+			checker.m.Lock()
+			checker.notices = []*InterruptNotice{real}
+			checker.m.Unlock()
+			r.NoError(handler.poll(context.Background(), &state))
+			r.NotNil(state.interruption)
+			r.Equal("terminate", state.interruption.Action)
+			r.True(state.localActionsStarted)
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package handler
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	"github.com/castai/spot-handler/metrics"
+)
+
+const (
+	// VolumeDetachAttachments deletes volume attachments of the node once pods using them are gone, so that
+	// volumes are detached before the VM goes away instead of waiting for the attach-detach controller timeout.
+	// The out-of-service taint is not a detach mode, handleOutOfService applies it only once the node is shut down,
+	// as force detaching volumes of a running VM can corrupt data.
+	VolumeDetachAttachments = "delete-attachments"
+
+	// csiVolumePrefix prefixes unique names of CSI volumes attached to the node, followed by driver^volumeHandle.
+	csiVolumePrefix = "kubernetes.io/csi/"
+
+	// volumeDetachReserve is the part of the drain deadline kept for volume detach, at most a quarter of it.
+	volumeDetachReserve = 15 * time.Second
+)
+
+// detachVolumes speeds up failover of stateful workloads once the node is drained.
+func (g *SpotHandler) detachVolumes(ctx context.Context, node *v1.Node) {
+	if g.drain.VolumeDetach != VolumeDetachAttachments {
+		return
+	}
+	if g.isDryRun() {
+		g.log.Infof("dry-run: would delete volume attachments of node %s", node.Name)
+		metrics.DryRunAction(operationDeleteVolumeAttachment)
+		return
+	}
+	if err := g.deleteVolumeAttachments(ctx); err != nil {
+		g.log.Errorf("deleting volume attachments: %v", err)
+	}
+}
+
+// deleteVolumeAttachments waits for pods on the node using persistent volumes to terminate and deletes volume
+// attachments of the node which are not used anymore.
+func (g *SpotHandler) deleteVolumeAttachments(ctx context.Context) error {
+	var inUse map[string]bool
+	// Claims of pods being deleted are bound already, so their volumes are looked up once.
+	claims := map[string]string{}
+	err := wait.PollUntilContextCancel(ctx, podDeletionPollInterval, true, func(ctx context.Context) (bool, error) {
+		var err error
+		inUse, err = g.volumesInUse(ctx, claims)
+		if err != nil {
+			return false, nil
+		}
+		return len(inUse) == 0, nil
+	})
+	if err != nil && inUse == nil {
+		return fmt.Errorf("listing volumes in use: %w", err)
+	}
+
+	// Volume attachments can't be listed by node, their names are derived from volumes attached to the node instead.
+	node, err := g.getNode(ctx)
+	if err != nil {
+		return fmt.Errorf("getting node: %w", err)
+	}
+	for _, attached := range node.Status.VolumesAttached {
+		name, ok := volumeAttachmentName(attached.Name, g.nodeName)
+		if !ok {
+			continue
+		}
+		va, err := g.clientset.StorageV1().VolumeAttachments().Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			if !apierrors.IsNotFound(err) {
+				g.log.Errorf("getting volume attachment %s: %v", name, err)
+			}
+			continue
+		}
+		pv := va.Spec.Source.PersistentVolumeName
+		if va.Spec.NodeName != g.nodeName || va.DeletionTimestamp != nil || pv == nil || inUse[*pv] {
+			continue
+		}
+		err = g.retry(ctx, operationDeleteVolumeAttachment, func() error {
+			err := g.clientset.StorageV1().VolumeAttachments().Delete(ctx, va.Name, metav1.DeleteOptions{})
+			if apierrors.IsNotFound(err) {
+				return nil
+			}
+			return err
+		})
+		if err != nil {
+			g.log.Errorf("deleting volume attachment %s: %v", va.Name, err)
+			continue
+		}
+		g.log.Infof("deleted volume attachment %s of persistent volume %s", va.Name, *pv)
+	}
+	return nil
+}
+
+// volumeAttachmentName returns the name of the volume attachment the attach-detach controller creates for a CSI
+// volume attached to the node, false for volumes of other plugins.
+func volumeAttachmentName(volume v1.UniqueVolumeName, nodeName string) (string, bool) {
+	name, ok := strings.CutPrefix(string(volume), csiVolumePrefix)
+	if !ok {
+		return "", false
+	}
+	driver, handle, ok := strings.Cut(name, "^")
+	if !ok {
+		return "", false
+	}
+	return fmt.Sprintf("csi-%x", sha256.Sum256([]byte(handle+driver+nodeName))), true
+}
+
+// volumesInUse returns names of persistent volumes used by pods on the node. Volumes of bound claims are kept in
+// claims between calls.
+func (g *SpotHandler) volumesInUse(ctx context.Context, claims map[string]string) (map[string]bool, error) {
+	pods, err := g.listNodePods(ctx)
+	if err != nil {
+		return nil, err
+	}
+	inUse := map[string]bool{}
+	for _, pod := range pods {
+		for _, v := range pod.Spec.Volumes {
+			if v.PersistentVolumeClaim == nil {
+				continue
+			}
+			key := pod.Namespace + "/" + v.PersistentVolumeClaim.ClaimName
+			volume, ok := claims[key]
+			if !ok {
+				pvc, err := g.clientset.CoreV1().PersistentVolumeClaims(pod.Namespace).Get(ctx, v.PersistentVolumeClaim.ClaimName, metav1.GetOptions{})
+				if err != nil {
+					return nil, err
+				}
+				volume = pvc.Spec.VolumeName
+				if volume != "" {
+					claims[key] = volume
+				}
+			}
+			if volume != "" {
+				inUse[volume] = true
+			}
+		}
+	}
+	return inUse, nil
+}
@@ -0,0 +1,130 @@
+package handler
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	ktest "k8s.io/client-go/testing"
+	"k8s.io/utils/ptr"
+)
+
+func TestDetachVolumes(t *testing.T) {
+	log := logrus.New()
+	nodeName := "AI"
+
+	newAttachment := func(volume v1.UniqueVolumeName, nodeName, pv string) *storagev1.VolumeAttachment {
+		name, ok := volumeAttachmentName(volume, nodeName)
+		require.True(t, ok)
+		return &storagev1.VolumeAttachment{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec: storagev1.VolumeAttachmentSpec{
+				NodeName: nodeName,
+				Source:   storagev1.VolumeAttachmentSource{PersistentVolumeName: ptr.To(pv)},
+			},
+		}
+	}
+
+	t.Run("delete attachments of volumes no longer in use", func(t *testing.T) {
+		r := require.New(t)
+
+		pod := &v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "default"},
+			Spec: v1.PodSpec{
+				NodeName: nodeName,
+				Volumes: []v1.Volume{{Name: "data", VolumeSource: v1.VolumeSource{
+					PersistentVolumeClaim: &v1.PersistentVolumeClaimVolumeSource{ClaimName: "data"},
+				}}},
+			},
+			Status: v1.PodStatus{Phase: v1.PodRunning},
+		}
+		pvc := &v1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{Name: "data", Namespace: "default"},
+			Spec:       v1.PersistentVolumeClaimSpec{VolumeName: "pv-in-use"},
+		}
+		node := &v1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: nodeName},
+			Status: v1.NodeStatus{VolumesAttached: []v1.AttachedVolume{
+				{Name: "kubernetes.io/csi/ebs.csi.aws.com^vol-unused"},
+				{Name: "kubernetes.io/csi/ebs.csi.aws.com^vol-in-use"},
+				{Name: "kubernetes.io/aws-ebs/vol-legacy"},
+			}},
+		}
+		inUse := newAttachment("kubernetes.io/csi/ebs.csi.aws.com^vol-in-use", nodeName, "pv-in-use")
+		otherNode := newAttachment("kubernetes.io/csi/ebs.csi.aws.com^vol-other", "other", "pv-other")
+		fakeApi := fake.NewSimpleClientset(node, pod, pvc,
+			newAttachment("kubernetes.io/csi/ebs.csi.aws.com^vol-unused", nodeName, "pv-unused"),
+			inUse,
+			otherNode,
+		)
+		var pvcGets atomic.Int32
+		fakeApi.PrependReactor("get", "persistentvolumeclaims", func(ktest.Action) (bool, runtime.Object, error) {
+			pvcGets.Add(1)
+			return false, nil, nil
+		})
+		var attachmentLists atomic.Int32
+		fakeApi.PrependReactor("list", "volumeattachments", func(ktest.Action) (bool, runtime.Object, error) {
+			attachmentLists.Add(1)
+			return false, nil, nil
+		})
+
+		handler := SpotHandler{
+			clientset: fakeApi,
+			nodeName:  nodeName,
+			log:       log,
+			drain:     DrainConfig{VolumeDetach: VolumeDetachAttachments},
+		}
+		// Pod using the volume doesn't terminate in time.
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		handler.detachVolumes(ctx, node)
+
+		// Claim of the pod is looked up once while waiting for it to terminate.
+		r.Equal(int32(1), pvcGets.Load())
+		r.Zero(attachmentLists.Load())
+		list, err := fakeApi.StorageV1().VolumeAttachments().List(context.Background(), metav1.ListOptions{})
+		r.NoError(err)
+		var names []string
+		for _, va := range list.Items {
+			names = append(names, va.Name)
+		}
+		r.ElementsMatch([]string{inUse.Name, otherNode.Name}, names)
+	})
+
+	t.Run("taint node out-of-service keeping existing taints", func(t *testing.T) {
+		r := require.New(t)
+
+		node := &v1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: nodeName},
+			Spec: v1.NodeSpec{Taints: []v1.Taint{
+				{Key: "other", Value: "value", Effect: v1.TaintEffectNoSchedule},
+			}},
+		}
+		fakeApi := fake.NewSimpleClientset(node)
+
+		handler := SpotHandler{
+			clientset:  fakeApi,
+			nodeName:   nodeName,
+			log:        log,
+			k8sVersion: testVersion(26),
+		}
+		r.NoError(handler.taintOutOfService(context.Background(), node))
+
+		got, err := fakeApi.CoreV1().Nodes().Get(context.Background(), nodeName, metav1.GetOptions{})
+		r.NoError(err)
+		r.True(got.Spec.Unschedulable)
+		r.ElementsMatch([]v1.Taint{
+			{Key: "other", Value: "value", Effect: v1.TaintEffectNoSchedule},
+			{Key: taintNodeDraining, Value: valueTrue, Effect: taintNodeDrainingEffect},
+			{Key: taintOutOfService, Value: taintOutOfServiceValue, Effect: taintOutOfServiceEffect},
+		}, got.Spec.Taints)
+	})
+}
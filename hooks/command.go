@@ -0,0 +1,62 @@
+package hooks
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// maxOutputLen limits command output included in errors.
+const maxOutputLen = 512
+
+type CommandConfig struct {
+	Name           string   `json:"name"`
+	Command        []string `json:"command"`
+	TimeoutSeconds int      `json:"timeoutSeconds,omitempty"`
+}
+
+// commandHook runs a command in the handler container.
+type commandHook struct {
+	name    string
+	command []string
+	timeout time.Duration
+}
+
+func newCommandHook(cfg CommandConfig, timeout time.Duration) *commandHook {
+	if cfg.TimeoutSeconds > 0 {
+		timeout = time.Duration(cfg.TimeoutSeconds) * time.Second
+	}
+	name := cfg.Name
+	if name == "" {
+		name = strings.Join(cfg.Command, " ")
+	}
+	return &commandHook{
+		name:    "command/" + name,
+		command: cfg.Command,
+		timeout: timeout,
+	}
+}
+
+func (h *commandHook) Name() string {
+	return h.name
+}
+
+func (h *commandHook) Run(ctx context.Context) error {
+	if len(h.command) == 0 {
+		return fmt.Errorf("command is empty")
+	}
+
+	ctx, cancel := withTimeout(ctx, h.timeout)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, h.command[0], h.command[1:]...).CombinedOutput()
+	if err != nil {
+		if len(out) > maxOutputLen {
+			out = out[:maxOutputLen]
+		}
+		return fmt.Errorf("running command: %w, output: %s", err, out)
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+// Package hooks runs pre-termination hooks when the node is about to be interrupted, e.g. to flush local caches
+// or deregister from external service discovery before the VM goes away.
+package hooks
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// AnnotationPreStopURL selects pods which are called on interruption. Host of the URL is replaced with the pod
+	// IP, e.g. "http://:8080/prestop".
+	AnnotationPreStopURL = "spot-handler.cast.ai/preStop-url"
+	// AnnotationPreStopTimeout overrides the default hook timeout, e.g. "10s".
+	AnnotationPreStopTimeout = "spot-handler.cast.ai/preStop-timeout"
+)
+
+type Hook interface {
+	Name() string
+	Run(ctx context.Context) error
+}
+
+type Result struct {
+	Hook     string
+	Duration time.Duration
+	Err      error
+}
+
+type Config struct {
+	// PodHooks enables calling pods on the node annotated with AnnotationPreStopURL.
+	PodHooks bool
+	Commands []CommandConfig
+	// Timeout of a single hook unless overridden.
+	Timeout time.Duration
+}
+
+type Runner struct {
+	log       logrus.FieldLogger
+	clientset kubernetes.Interface
+	nodeName  string
+	cfg       Config
+}
+
+func NewRunner(log logrus.FieldLogger, clientset kubernetes.Interface, nodeName string, cfg Config) *Runner {
+	return &Runner{
+		log:       log,
+		clientset: clientset,
+		nodeName:  nodeName,
+		cfg:       cfg,
+	}
+}
+
+// Enabled returns true if any hooks are configured.
+func (r *Runner) Enabled() bool {
+	return r.cfg.PodHooks || len(r.cfg.Commands) > 0
+}
+
+// Run runs all hooks concurrently, each bounded by its timeout and ctx, and returns their results.
+func (r *Runner) Run(ctx context.Context) []Result {
+	var hooks []Hook
+	for _, c := range r.cfg.Commands {
+		hooks = append(hooks, newCommandHook(c, r.cfg.Timeout))
+	}
+	if r.cfg.PodHooks {
+		podHooks, err := r.podHooks(ctx)
+		if err != nil {
+			// Commands are still run, pod hooks are reported as a single failure.
+			r.log.Errorf("listing pod hooks: %v", err)
+			hooks = append(hooks, failedHook{name: "pods", err: err})
+		}
+		hooks = append(hooks, podHooks...)
+	}
+
+	results := make([]Result, len(hooks))
+	var wg sync.WaitGroup
+	for i, h := range hooks {
+		wg.Add(1)
+		go func(i int, h Hook) {
+			defer wg.Done()
+			start := time.Now()
+			err := h.Run(ctx)
+			results[i] = Result{Hook: h.Name(), Duration: time.Since(start), Err: err}
+		}(i, h)
+	}
+	wg.Wait()
+	return results
+}
+
+func (r *Runner) podHooks(ctx context.Context) ([]Hook, error) {
+	pods, err := r.clientset.CoreV1().Pods(metav1.NamespaceAll).List(ctx, metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("spec.nodeName", r.nodeName).String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var hooks []Hook
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.Spec.NodeName != r.nodeName || pod.Annotations[AnnotationPreStopURL] == "" || pod.Status.Phase != v1.PodRunning {
+			continue
+		}
+		hook, err := newPodHTTPHook(pod, r.cfg.Timeout)
+		if err != nil {
+			hooks = append(hooks, failedHook{name: podHookName(pod), err: err})
+			continue
+		}
+		hooks = append(hooks, hook)
+	}
+	return hooks, nil
+}
+
+// failedHook reports an error which prevented the hook from being created.
+type failedHook struct {
+	name string
+	err  error
+}
+
+func (h failedHook) Name() string {
+	return h.name
+}
+
+func (h failedHook) Run(_ context.Context) error {
+	return fmt.Errorf("creating hook: %w", h.err)
+}
@@ -0,0 +1,133 @@
+package hooks
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestRunner(t *testing.T) {
+	log := logrus.New()
+	nodeName := "node1"
+
+	newPod := func(name, node, preStopURL string) *v1.Pod {
+		return &v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        name,
+				Namespace:   "default",
+				Annotations: map[string]string{AnnotationPreStopURL: preStopURL},
+			},
+			Spec: v1.PodSpec{NodeName: node},
+			Status: v1.PodStatus{
+				Phase: v1.PodRunning,
+				PodIP: "127.0.0.1",
+			},
+		}
+	}
+
+	t.Run("call annotated pods on the node and run commands", func(t *testing.T) {
+		r := require.New(t)
+
+		calls := make(chan string, 10)
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			calls <- req.Method + " " + req.URL.Path
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer srv.Close()
+		u, err := url.Parse(srv.URL)
+		r.NoError(err)
+		_, port, err := net.SplitHostPort(u.Host)
+		r.NoError(err)
+
+		clientset := fake.NewSimpleClientset(
+			newPod("annotated", nodeName, "http://:"+port+"/prestop"),
+			newPod("other-node", "node2", "http://:"+port+"/other"),
+			&v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "not-annotated", Namespace: "default"}, Spec: v1.PodSpec{NodeName: nodeName}},
+		)
+		runner := NewRunner(log, clientset, nodeName, Config{
+			PodHooks: true,
+			Commands: []CommandConfig{{Name: "ok", Command: []string{"true"}}},
+			Timeout:  time.Second,
+		})
+		r.True(runner.Enabled())
+
+		results := runner.Run(context.Background())
+		sort.Slice(results, func(i, j int) bool { return results[i].Hook < results[j].Hook })
+		r.Len(results, 2)
+		r.Equal("command/ok", results[0].Hook)
+		r.NoError(results[0].Err)
+		r.Equal("pod/default/annotated", results[1].Hook)
+		r.NoError(results[1].Err)
+		r.Len(calls, 1)
+		r.Equal("POST /prestop", <-calls)
+	})
+
+	t.Run("report failed and timed out hooks", func(t *testing.T) {
+		r := require.New(t)
+
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		defer srv.Close()
+		u, err := url.Parse(srv.URL)
+		r.NoError(err)
+		_, port, err := net.SplitHostPort(u.Host)
+		r.NoError(err)
+
+		clientset := fake.NewSimpleClientset(newPod("failing", nodeName, "http://:"+port+"/prestop"))
+		runner := NewRunner(log, clientset, nodeName, Config{
+			PodHooks: true,
+			Commands: []CommandConfig{{Name: "slow", Command: []string{"sleep", "10"}, TimeoutSeconds: 1}},
+		})
+
+		start := time.Now()
+		results := runner.Run(context.Background())
+		r.Less(time.Since(start), 5*time.Second)
+		r.Len(results, 2)
+		for _, res := range results {
+			r.Error(res.Err, res.Hook)
+		}
+	})
+
+	t.Run("disabled without hooks", func(t *testing.T) {
+		r := require.New(t)
+		runner := NewRunner(log, fake.NewSimpleClientset(), nodeName, Config{})
+		r.False(runner.Enabled())
+	})
+}
+
+func TestNewPodHTTPHook(t *testing.T) {
+	tests := []struct {
+		name       string
+		podIP      string
+		preStopURL string
+		want       string
+	}{
+		{name: "IPv4 with port", podIP: "10.0.0.1", preStopURL: "http://:8080/prestop", want: "http://10.0.0.1:8080/prestop"},
+		{name: "IPv6 with port", podIP: "fd00::1", preStopURL: "http://:8080/prestop", want: "http://[fd00::1]:8080/prestop"},
+		{name: "IPv6 without port", podIP: "fd00::1", preStopURL: "/prestop", want: "http://[fd00::1]:80/prestop"},
+		{name: "https without port", podIP: "10.0.0.1", preStopURL: "https:///prestop", want: "https://10.0.0.1:443/prestop"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := require.New(t)
+			hook, err := newPodHTTPHook(&v1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{AnnotationPreStopURL: tt.preStopURL}},
+				Status:     v1.PodStatus{PodIP: tt.podIP},
+			}, time.Second)
+			r.NoError(err)
+			r.Equal(tt.want, hook.url)
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package hooks
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	v1 "k8s.io/api/core/v1"
+)
+
+// defaultPorts are used when the pre-stop URL doesn't set the port, so that the host is valid for IPv6 pod IPs too.
+var defaultPorts = map[string]string{"http": "80", "https": "443"}
+
+// podHTTPHook calls the pre-stop URL of a pod on the node.
+type podHTTPHook struct {
+	name    string
+	url     string
+	timeout time.Duration
+	client  *resty.Client
+}
+
+func newPodHTTPHook(pod *v1.Pod, timeout time.Duration) (*podHTTPHook, error) {
+	if pod.Status.PodIP == "" {
+		return nil, fmt.Errorf("pod has no IP")
+	}
+
+	u, err := url.Parse(pod.Annotations[AnnotationPreStopURL])
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s annotation: %w", AnnotationPreStopURL, err)
+	}
+	if u.Scheme == "" {
+		u.Scheme = "http"
+	}
+	port := u.Port()
+	if port == "" {
+		port = defaultPorts[u.Scheme]
+	}
+	u.Host = net.JoinHostPort(pod.Status.PodIP, port)
+
+	if v := pod.Annotations[AnnotationPreStopTimeout]; v != "" {
+		timeout, err = time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("parsing %s annotation: %w", AnnotationPreStopTimeout, err)
+		}
+	}
+
+	return &podHTTPHook{
+		name:    podHookName(pod),
+		url:     u.String(),
+		timeout: timeout,
+		client:  resty.New(),
+	}, nil
+}
+
+func podHookName(pod *v1.Pod) string {
+	return "pod/" + pod.Namespace + "/" + pod.Name
+}
+
+func (h *podHTTPHook) Name() string {
+	return h.name
+}
+
+func (h *podHTTPHook) Run(ctx context.Context) error {
+	ctx, cancel := withTimeout(ctx, h.timeout)
+	defer cancel()
+
+	resp, err := h.client.R().SetContext(ctx).Post(h.url)
+	if err != nil {
+		return fmt.Errorf("calling %s: %w", h.url, err)
+	}
+	if resp.IsError() {
+		return fmt.Errorf("calling %s: request error status_code=%d body=%s", h.url, resp.StatusCode(), resp.Body())
+	}
+	return nil
+}
+
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
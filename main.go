@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
@@ -12,11 +13,15 @@ import (
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/manager/signals"
 
 	"github.com/castai/spot-handler/castai"
 	"github.com/castai/spot-handler/config"
 	"github.com/castai/spot-handler/handler"
+	"github.com/castai/spot-handler/hooks"
+	"github.com/castai/spot-handler/metrics"
+	"github.com/castai/spot-handler/notifier"
 	"github.com/castai/spot-handler/version"
 )
 
@@ -27,11 +32,29 @@ var (
 )
 
 func main() {
-	cfg := config.Get()
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "simulate":
+			runSimulate(os.Args[2:])
+			return
+		case "fake-imds":
+			runFakeIMDS(os.Args[2:])
+			return
+		case "validate-config":
+			runValidateConfig()
+			return
+		}
+	}
 
 	logger := logrus.New()
 	log := logrus.WithFields(logrus.Fields{})
 
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("loading configuration: %v", err)
+	}
+	logger.SetLevel(logrus.Level(cfg.LogLevel))
+
 	kubeconfig, err := retrieveKubeConfig(log, cfg)
 	if err != nil {
 		log.Fatalf("err retrieving kubeconfig: %v", err)
@@ -65,35 +88,33 @@ func main() {
 	log = log.WithFields(logrus.Fields{
 		"k8s_version": k8sVersionField,
 	})
+	log.Infof("kubernetes capabilities: %+v", version.CapabilitiesOf(k8sVersion))
 
-	interruptChecker, err := buildInterruptChecker(cfg.Provider)
+	interruptChecker, err := buildInterruptChecker(cfg.Provider, cfg.MetadataURL)
 	if err != nil {
 		log.Fatalf("interrupt checker: %v", err)
 	}
 
-	// Set 5 seconds until we timeout calling mothership and retry.
-	castHttpClient, err := castai.NewRestyClient(
-		cfg.APIUrl,
-		cfg.APIKey,
-		cfg.TLSCACert,
-		logrus.Level(cfg.LogLevel),
-		5*time.Second,
-		Version,
-	)
-	if err != nil {
-		log.Fatalf("failed to create http client: %v", err)
+	if cfg.SimulationPort != 0 {
+		injector := handler.NewNoticeInjector(interruptChecker, cfg.SimulationToken)
+		interruptChecker = injector
+		go func() {
+			// Simulation endpoint is reachable only from within the pod.
+			addr := fmt.Sprintf("127.0.0.1:%d", cfg.SimulationPort)
+			log.Infof("starting simulation server on %s", addr)
+			mux := http.NewServeMux()
+			mux.Handle(simulatePath, injector)
+			if err := http.ListenAndServe(addr, mux); err != nil {
+				log.Errorf("failed to start simulation http server: %v", err)
+			}
+		}()
 	}
-	castClient := castai.NewClient(logger, castHttpClient, cfg.ClusterID)
 
-	spotHandler := handler.NewSpotHandler(
-		log,
-		castClient,
-		clientset,
-		interruptChecker,
-		time.Duration(cfg.PollIntervalSeconds)*time.Second,
-		cfg.NodeName,
-		cfg.Phase2Permissions,
-	)
+	recorder, stopEvents := handler.NewEventRecorder(clientset, k8sVersion, cfg.NodeName)
+	spotHandler, err := newSpotHandler(log, logger, cfg, clientset, k8sVersion, interruptChecker, recorder)
+	if err != nil {
+		log.Fatalf("failed to create spot handler: %v", err)
+	}
 
 	if cfg.PprofPort != 0 {
 		go func() {
@@ -105,8 +126,38 @@ func main() {
 		}()
 	}
 
+	if cfg.MetricsPort != 0 {
+		go func() {
+			addr := fmt.Sprintf(":%d", cfg.MetricsPort)
+			log.Infof("starting metrics server on %s", addr)
+			mux := http.NewServeMux()
+			mux.Handle("/metrics", metrics.Handler())
+			if err := http.ListenAndServe(addr, mux); err != nil {
+				log.Errorf("failed to start metrics http server: %v", err)
+			}
+		}()
+	}
+
+	if cfg.Standalone {
+		log.Info("standalone mode enabled, mothership won't be notified")
+	}
+	if cfg.DryRun {
+		log.Warn("dry-run mode enabled, mothership won't be notified and node won't be changed")
+	}
+
+	err = config.Watch(func(cfg config.Config) {
+		reloadConfig(log, logger, spotHandler, cfg)
+	}, func(err error) {
+		log.Errorf("ignoring config file change: %v", err)
+	})
+	if err != nil {
+		log.Fatalf("watching config file: %v", err)
+	}
+
 	log.Infof("running spot handler, provider=%s", cfg.Provider)
-	if err := spotHandler.Run(signals.SetupSignalHandler()); err != nil {
+	err = spotHandler.Run(signals.SetupSignalHandler())
+	stopEvents()
+	if err != nil {
 		logErr := &logContextErr{}
 		if errors.As(err, &logErr) {
 			log = logger.WithFields(logErr.fields)
@@ -115,14 +166,159 @@ func main() {
 	}
 }
 
-func buildInterruptChecker(provider string) (handler.MetadataChecker, error) {
+func newSpotHandler(
+	log *logrus.Entry,
+	logger *logrus.Logger,
+	cfg config.Config,
+	clientset kubernetes.Interface,
+	k8sVersion version.Interface,
+	interruptChecker handler.MetadataChecker,
+	recorder record.EventRecorder,
+) (*handler.SpotHandler, error) {
+	var castClient castai.Client
+	if !cfg.Standalone {
+		// Set 5 seconds until we timeout calling mothership and retry.
+		castHttpClient, err := castai.NewRestyClient(
+			cfg.APIUrl,
+			cfg.APIKey,
+			castai.TLSConfig{
+				CACert:         cfg.TLSCACert,
+				ClientCertFile: cfg.TLS.ClientCertFile,
+				ClientKeyFile:  cfg.TLS.ClientKeyFile,
+				MinVersion:     cfg.TLS.MinVersion,
+			},
+			logrus.Level(cfg.LogLevel),
+			5*time.Second,
+			Version,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("creating http client: %w", err)
+		}
+		castai.WatchTLS(log, castHttpClient, time.Duration(cfg.TLS.ReloadIntervalSeconds)*time.Second, nil)
+		if cfg.APIKeyFile != "" {
+			keyFile, err := castai.NewAPIKeyFile(log, cfg.APIKeyFile)
+			if err != nil {
+				return nil, err
+			}
+			keyFile.Use(castHttpClient)
+			if err := keyFile.Watch(nil); err != nil {
+				return nil, err
+			}
+		}
+		batch := castai.DefaultBatchConfig()
+		batch.Window = time.Duration(cfg.MothershipBatchWindowMillis) * time.Millisecond
+		batch.Gzip = cfg.MothershipGzip
+		castClient = castai.NewClient(logger, castHttpClient, cfg.ClusterID, batch)
+	}
+
+	notifiers, err := newNotifiers(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var hookRunner *hooks.Runner
+	if cfg.Hooks.Pods || cfg.Hooks.Commands != "" {
+		var commands []hooks.CommandConfig
+		if cfg.Hooks.Commands != "" {
+			if err := json.Unmarshal([]byte(cfg.Hooks.Commands), &commands); err != nil {
+				return nil, fmt.Errorf("parsing PRE_TERMINATION_COMMANDS: %w", err)
+			}
+		}
+		hookRunner = hooks.NewRunner(log, clientset, cfg.NodeName, hooks.Config{
+			PodHooks: cfg.Hooks.Pods,
+			Commands: commands,
+			Timeout:  time.Duration(cfg.Hooks.TimeoutSeconds) * time.Second,
+		})
+	}
+
+	drain := handler.DrainConfig{
+		Enabled:          cfg.Drain.Enabled,
+		Concurrency:      cfg.Drain.Concurrency,
+		Timeout:          time.Duration(cfg.Drain.TimeoutSeconds) * time.Second,
+		Strategy:         cfg.Drain.Strategy,
+		MinReadyReplicas: cfg.Drain.MinReadyReplicas,
+		VolumeDetach:     cfg.Drain.VolumeDetach,
+	}
+	if cfg.Drain.Groups != "" {
+		if err := json.Unmarshal([]byte(cfg.Drain.Groups), &drain.Groups); err != nil {
+			return nil, fmt.Errorf("parsing DRAIN_GROUPS: %w", err)
+		}
+	}
+
+	return handler.NewSpotHandler(
+		log,
+		castClient,
+		clientset,
+		interruptChecker,
+		cfg.NodeName,
+		handler.Options{
+			PollInterval:      time.Duration(cfg.PollIntervalSeconds) * time.Second,
+			PollTimeout:       time.Duration(cfg.PollTimeoutSeconds) * time.Second,
+			GracePeriod:       time.Duration(cfg.ShutdownGracePeriodSeconds) * time.Second,
+			Phase2Permissions: cfg.Phase2Permissions,
+			Retry: handler.RetryConfig{
+				InitialInterval: time.Duration(cfg.RetryInitialIntervalMillis) * time.Millisecond,
+				MaxInterval:     time.Duration(cfg.RetryMaxIntervalSeconds) * time.Second,
+				MaxElapsedTime:  time.Duration(cfg.RetryMaxElapsedSeconds) * time.Second,
+			},
+			DryRun:            cfg.DryRun,
+			Notifiers:         notifiers,
+			AnnotatePods:      cfg.AnnotatePods,
+			Drain:             drain,
+			OutOfServiceTaint: cfg.OutOfServiceTaint,
+			KubernetesVersion: k8sVersion,
+			Hooks:             hookRunner,
+			Recorder:          recorder,
+			Version:           Version,
+			Provider:          cfg.Provider,
+			HeartbeatInterval: time.Duration(cfg.HeartbeatIntervalSeconds) * time.Second,
+		},
+	), nil
+}
+
+func newNotifiers(cfg config.Config) ([]notifier.Notifier, error) {
+	var notifiers []notifier.Notifier
+	if cfg.Webhook.URL != "" {
+		webhook, err := notifier.NewWebhook(notifier.WebhookConfig{
+			URL:        cfg.Webhook.URL,
+			Template:   cfg.Webhook.Template,
+			Secret:     cfg.Webhook.Secret,
+			Timeout:    time.Duration(cfg.Webhook.TimeoutSeconds) * time.Second,
+			MaxRetries: uint64(cfg.Webhook.MaxRetries),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("creating webhook notifier: %w", err)
+		}
+		notifiers = append(notifiers, webhook)
+	}
+	return notifiers, nil
+}
+
+// reloadConfig applies settings which can be changed without restart, other settings are ignored until restart.
+func reloadConfig(log *logrus.Entry, logger *logrus.Logger, spotHandler *handler.SpotHandler, cfg config.Config) {
+	notifiers, err := newNotifiers(cfg)
+	if err != nil {
+		log.Errorf("reloading configuration: %v", err)
+		return
+	}
+	logger.SetLevel(logrus.Level(cfg.LogLevel))
+	spotHandler.Reconfigure(handler.RuntimeConfig{
+		PollInterval: time.Duration(cfg.PollIntervalSeconds) * time.Second,
+		DryRun:       cfg.DryRun,
+		Notifiers:    notifiers,
+	})
+	log.Infof("configuration reloaded, log_level=%d poll_interval_seconds=%d dry_run=%t notifiers=%d",
+		cfg.LogLevel, cfg.PollIntervalSeconds, cfg.DryRun, len(notifiers))
+}
+
+func buildInterruptChecker(provider, metadataURL string) (handler.MetadataChecker, error) {
 	switch provider {
 	case "azure":
-		return handler.NewAzureInterruptChecker(), nil
+		return handler.NewAzureInterruptChecker(metadataURL), nil
 	case "gcp":
-		return handler.NewGCPChecker(), nil
+		return handler.NewGCPChecker(metadataURL)
 	case "aws":
-		return handler.NewAWSInterruptChecker(), nil
+		return handler.NewAWSInterruptChecker(metadataURL), nil
 	default:
 		return nil, fmt.Errorf("unknown provider: %s", provider)
 	}
@@ -0,0 +1,102 @@
+package metadatafake
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-node-termination-handler/pkg/ec2metadata"
+)
+
+const (
+	awsTokenPath      = "/latest/api/token"
+	awsTokenHeader    = "X-aws-ec2-metadata-token"
+	awsTokenTTLHeader = "X-aws-ec2-metadata-token-ttl-seconds"
+	awsToken          = "fake-imds-token"
+
+	awsScheduledEventTimeFormat = "2 Jan 2006 15:04:05 GMT"
+)
+
+func (s *Server) registerAWS() {
+	s.mux.HandleFunc(awsTokenPath, s.awsToken)
+	s.mux.HandleFunc(ec2metadata.SpotInstanceActionPath, s.awsAuthorized(s.awsInstanceAction))
+	s.mux.HandleFunc(ec2metadata.RebalanceRecommendationPath, s.awsAuthorized(s.awsRebalanceRecommendation))
+	s.mux.HandleFunc(ec2metadata.ScheduledEventPath, s.awsAuthorized(s.awsScheduledEvents))
+}
+
+// awsToken issues IMDSv2 session tokens.
+func (s *Server) awsToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	ttl := r.Header.Get(awsTokenTTLHeader)
+	if ttl == "" {
+		http.Error(w, "missing token ttl", http.StatusBadRequest)
+		return
+	}
+	w.Header().Set(awsTokenTTLHeader, ttl)
+	_, _ = w.Write([]byte(awsToken))
+}
+
+// awsAuthorized requires IMDSv2 session token.
+func (s *Server) awsAuthorized(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(awsTokenHeader) != awsToken {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+func (s *Server) awsInstanceAction(w http.ResponseWriter, _ *http.Request) {
+	st := s.snapshot()
+	if st.interruption == nil {
+		http.NotFound(w, nil)
+		return
+	}
+	writeJSON(w, ec2metadata.InstanceAction{
+		Action: "terminate",
+		Time:   st.interruption.time.Format(time.RFC3339),
+	})
+}
+
+func (s *Server) awsRebalanceRecommendation(w http.ResponseWriter, _ *http.Request) {
+	st := s.snapshot()
+	if st.rebalance == nil {
+		http.NotFound(w, nil)
+		return
+	}
+	writeJSON(w, ec2metadata.RebalanceRecommendation{
+		NoticeTime: st.rebalance.Format(time.RFC3339),
+	})
+}
+
+func (s *Server) awsScheduledEvents(w http.ResponseWriter, _ *http.Request) {
+	st := s.snapshot()
+	events := []ec2metadata.ScheduledEventDetail{}
+	if st.maintenance != nil {
+		state := "active"
+		switch st.maintenance.status {
+		case StatusStarted:
+			state = "started"
+		case StatusCompleted:
+			state = "completed"
+		}
+		events = append(events, ec2metadata.ScheduledEventDetail{
+			Code:        "system-reboot",
+			Description: "fake scheduled maintenance",
+			EventID:     st.maintenance.id,
+			NotBefore:   st.maintenance.time.Format(awsScheduledEventTimeFormat),
+			NotAfter:    st.maintenance.time.Add(2 * time.Hour).Format(awsScheduledEventTimeFormat),
+			State:       state,
+		})
+	}
+	writeJSON(w, events)
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,66 @@
+package metadatafake
+
+import (
+	"net/http"
+)
+
+const azureScheduledEventsPath = "/metadata/scheduledevents"
+
+type azureScheduledEvent struct {
+	EventId           string
+	EventType         string
+	ResourceType      string
+	Resources         []string
+	EventStatus       string
+	NotBefore         string
+	Description       string
+	EventSource       string
+	DurationInSeconds int
+}
+
+type azureScheduledEvents struct {
+	DocumentIncarnation int
+	Events              []azureScheduledEvent
+}
+
+func (s *Server) registerAzure() {
+	s.mux.HandleFunc(azureScheduledEventsPath, s.azureScheduledEvents)
+}
+
+func (s *Server) azureScheduledEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Metadata") != "true" {
+		http.Error(w, "missing Metadata header", http.StatusBadRequest)
+		return
+	}
+
+	st := s.snapshot()
+	resp := azureScheduledEvents{
+		DocumentIncarnation: st.incarnation,
+		Events:              []azureScheduledEvent{},
+	}
+	if st.interruption != nil {
+		resp.Events = append(resp.Events, azureEvent(st.interruption, "Preempt"))
+	}
+	if st.maintenance != nil {
+		resp.Events = append(resp.Events, azureEvent(st.maintenance, "Redeploy"))
+	}
+	writeJSON(w, resp)
+}
+
+func azureEvent(n *notice, eventType string) azureScheduledEvent {
+	e := azureScheduledEvent{
+		EventId:           n.id,
+		EventType:         eventType,
+		ResourceType:      "VirtualMachine",
+		Resources:         []string{"fake-vm"},
+		EventStatus:       n.status,
+		Description:       "fake " + eventType + " event",
+		EventSource:       "Platform",
+		DurationInSeconds: -1,
+	}
+	// NotBefore is reported only for scheduled events.
+	if n.status == StatusScheduled {
+		e.NotBefore = n.time.Format(http.TimeFormat)
+	}
+	return e
+}
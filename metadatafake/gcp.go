@@ -0,0 +1,84 @@
+package metadatafake
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	gcpPreemptedPath   = "/computeMetadata/v1/instance/preempted"
+	gcpMaintenancePath = "/computeMetadata/v1/instance/maintenance-event"
+
+	gcpDefaultWaitTimeout = 5 * time.Minute
+)
+
+func (s *Server) registerGCP() {
+	s.mux.HandleFunc(gcpPreemptedPath, s.gcpValue(func(st snapshot) string {
+		if st.interruption != nil {
+			return "TRUE"
+		}
+		return "FALSE"
+	}))
+	s.mux.HandleFunc(gcpMaintenancePath, s.gcpValue(func(st snapshot) string {
+		// Maintenance event is cleared once the maintenance is over.
+		if st.maintenance != nil && st.maintenance.status != StatusCompleted {
+			return "TERMINATE_ON_HOST_MAINTENANCE"
+		}
+		return "NONE"
+	}))
+}
+
+// gcpValue serves the metadata value, supporting wait_for_change and last_etag query parameters.
+func (s *Server) gcpValue(value func(snapshot) string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata-Flavor") != "Google" {
+			http.Error(w, "missing Metadata-Flavor header", http.StatusForbidden)
+			return
+		}
+
+		st := s.snapshot()
+		v := value(st)
+
+		q := r.URL.Query()
+		if q.Get("wait_for_change") == "true" {
+			timeout := gcpDefaultWaitTimeout
+			if sec, err := strconv.Atoi(q.Get("timeout_sec")); err == nil && sec > 0 {
+				timeout = time.Duration(sec) * time.Second
+			}
+			timer := time.NewTimer(timeout)
+			defer timer.Stop()
+
+			// Without last_etag the request waits for the next change of the value.
+			lastETag := q.Get("last_etag")
+			if lastETag == "" {
+				lastETag = gcpETag(v)
+			}
+		wait:
+			for gcpETag(v) == lastETag {
+				select {
+				case <-st.changed:
+					st = s.snapshot()
+					v = value(st)
+				case <-timer.C:
+					break wait
+				case <-r.Context().Done():
+					return
+				}
+			}
+		}
+
+		w.Header().Set("Metadata-Flavor", "Google")
+		w.Header().Set("ETag", gcpETag(v))
+		w.Header().Set("Content-Type", "application/text")
+		_, _ = w.Write([]byte(v))
+	}
+}
+
+func gcpETag(v string) string {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(v))
+	return fmt.Sprintf("%016x", h.Sum64())
+}
@@ -0,0 +1,195 @@
+// Package metadatafake emulates interruption related endpoints of AWS, GCP and Azure instance metadata services.
+// Notices are set directly or played from a timeline, so that the handler can be run against it locally, in kind
+// clusters and in tests.
+package metadatafake
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	TypeInterrupted = "interrupted"
+	TypeRebalance   = "rebalance"
+	TypeMaintenance = "maintenance"
+	// TypeClear removes all notices.
+	TypeClear = "clear"
+
+	StatusScheduled = "Scheduled"
+	StatusStarted   = "Started"
+	StatusCompleted = "Completed"
+
+	defaultNoticeIn = 2 * time.Minute
+)
+
+// Step of the timeline changing notices reported by the server.
+type Step struct {
+	// After is the delay since the start of the timeline.
+	After metav1.Duration `json:"after"`
+	// Type is one of Type* values.
+	Type string `json:"type"`
+	// Status of the interruption or maintenance, one of Status* values. Defaults to Scheduled.
+	Status string `json:"status,omitempty"`
+	// NoticeIn is the time until the interruption or maintenance. Defaults to 2 minutes.
+	NoticeIn metav1.Duration `json:"noticeIn,omitempty"`
+}
+
+// LoadTimeline reads timeline steps from a YAML or JSON file.
+func LoadTimeline(path string) ([]Step, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading timeline: %w", err)
+	}
+	var steps []Step
+	if err := yaml.Unmarshal(data, &steps); err != nil {
+		return nil, fmt.Errorf("parsing timeline: %w", err)
+	}
+	for _, s := range steps {
+		if err := s.validate(); err != nil {
+			return nil, err
+		}
+	}
+	return steps, nil
+}
+
+func (s Step) validate() error {
+	switch s.Type {
+	case TypeInterrupted, TypeRebalance, TypeMaintenance, TypeClear:
+	default:
+		return fmt.Errorf("unknown step type %q", s.Type)
+	}
+	switch s.Status {
+	case "", StatusScheduled, StatusStarted, StatusCompleted:
+	default:
+		return fmt.Errorf("unknown step status %q", s.Status)
+	}
+	return nil
+}
+
+type notice struct {
+	id     string
+	status string
+	time   time.Time
+}
+
+// Server serves the emulated metadata endpoints of all providers.
+type Server struct {
+	mux *http.ServeMux
+
+	mu           sync.Mutex
+	interruption *notice
+	maintenance  *notice
+	rebalance    *time.Time
+	// incarnation is increased on every change, it's reported by Azure scheduled events.
+	incarnation int
+	// changed is closed and replaced on every change to wake up GCP wait_for_change requests.
+	changed chan struct{}
+}
+
+func New() *Server {
+	s := &Server{
+		mux:     http.NewServeMux(),
+		changed: make(chan struct{}),
+	}
+	s.registerAWS()
+	s.registerGCP()
+	s.registerAzure()
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// Apply changes notices reported by the server according to the step, After is ignored.
+func (s *Server) Apply(step Step) error {
+	if err := step.validate(); err != nil {
+		return err
+	}
+
+	noticeIn := step.NoticeIn.Duration
+	if noticeIn == 0 {
+		noticeIn = defaultNoticeIn
+	}
+	status := step.Status
+	if status == "" {
+		status = StatusScheduled
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.incarnation++
+	n := &notice{
+		id:     fmt.Sprintf("fake-event-%d", s.incarnation),
+		status: status,
+		time:   time.Now().Add(noticeIn).UTC().Truncate(time.Second),
+	}
+	switch step.Type {
+	case TypeInterrupted:
+		if s.interruption != nil {
+			// Keep the event ID when an existing notice is updated.
+			n.id = s.interruption.id
+		}
+		s.interruption = n
+	case TypeMaintenance:
+		if s.maintenance != nil {
+			n.id = s.maintenance.id
+		}
+		s.maintenance = n
+	case TypeRebalance:
+		now := time.Now().UTC().Truncate(time.Second)
+		s.rebalance = &now
+	case TypeClear:
+		s.interruption = nil
+		s.maintenance = nil
+		s.rebalance = nil
+	}
+
+	close(s.changed)
+	s.changed = make(chan struct{})
+	return nil
+}
+
+// Play applies timeline steps at their time until all steps are applied or ctx is done.
+func (s *Server) Play(ctx context.Context, steps []Step) error {
+	start := time.Now()
+	for _, step := range steps {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Until(start.Add(step.After.Duration))):
+		}
+		if err := s.Apply(step); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type snapshot struct {
+	interruption *notice
+	maintenance  *notice
+	rebalance    *time.Time
+	incarnation  int
+	changed      <-chan struct{}
+}
+
+func (s *Server) snapshot() snapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return snapshot{
+		interruption: s.interruption,
+		maintenance:  s.maintenance,
+		rebalance:    s.rebalance,
+		incarnation:  s.incarnation,
+		changed:      s.changed,
+	}
+}
@@ -0,0 +1,131 @@
+package metadatafake
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-node-termination-handler/pkg/ec2metadata"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestServer(t *testing.T) {
+	t.Run("aws imdsv2 notices", func(t *testing.T) {
+		r := require.New(t)
+		srv := New()
+		s := httptest.NewServer(srv)
+		defer s.Close()
+
+		imds := ec2metadata.New(s.URL, 1)
+		action, err := imds.GetSpotITNEvent()
+		r.NoError(err)
+		r.Nil(action)
+
+		r.NoError(srv.Apply(Step{Type: TypeInterrupted}))
+		r.NoError(srv.Apply(Step{Type: TypeRebalance}))
+
+		action, err = imds.GetSpotITNEvent()
+		r.NoError(err)
+		r.NotNil(action)
+		r.Equal("terminate", action.Action)
+
+		rebalance, err := imds.GetRebalanceRecommendationEvent()
+		r.NoError(err)
+		r.NotNil(rebalance)
+
+		resp, err := http.Get(s.URL + ec2metadata.SpotInstanceActionPath)
+		r.NoError(err)
+		defer resp.Body.Close()
+		r.Equal(http.StatusUnauthorized, resp.StatusCode, "requests without token must be rejected")
+	})
+
+	t.Run("gcp wait for change", func(t *testing.T) {
+		r := require.New(t)
+		srv := New()
+		s := httptest.NewServer(srv)
+		defer s.Close()
+
+		go func() {
+			time.Sleep(100 * time.Millisecond)
+			_ = srv.Apply(Step{Type: TypeInterrupted})
+		}()
+
+		req, err := http.NewRequest(http.MethodGet, s.URL+gcpPreemptedPath+"?wait_for_change=true&timeout_sec=5", nil)
+		r.NoError(err)
+		req.Header.Set("Metadata-Flavor", "Google")
+		resp, err := http.DefaultClient.Do(req)
+		r.NoError(err)
+		defer resp.Body.Close()
+
+		body, err := io.ReadAll(resp.Body)
+		r.NoError(err)
+		r.Equal("TRUE", string(body))
+	})
+
+	t.Run("azure scheduled events", func(t *testing.T) {
+		r := require.New(t)
+		srv := New()
+		s := httptest.NewServer(srv)
+		defer s.Close()
+
+		r.NoError(srv.Apply(Step{Type: TypeInterrupted, Status: StatusStarted}))
+
+		req, err := http.NewRequest(http.MethodGet, s.URL+azureScheduledEventsPath+"?api-version=2020-07-01", nil)
+		r.NoError(err)
+		req.Header.Set("Metadata", "true")
+		resp, err := http.DefaultClient.Do(req)
+		r.NoError(err)
+		defer resp.Body.Close()
+
+		var events azureScheduledEvents
+		r.NoError(json.NewDecoder(resp.Body).Decode(&events))
+		r.Len(events.Events, 1)
+		r.Equal("Preempt", events.Events[0].EventType)
+		r.Equal(StatusStarted, events.Events[0].EventStatus)
+		r.Empty(events.Events[0].NotBefore)
+	})
+
+	t.Run("play timeline", func(t *testing.T) {
+		r := require.New(t)
+		srv := New()
+
+		path := filepath.Join(t.TempDir(), "timeline.yaml")
+		r.NoError(os.WriteFile(path, []byte(`
+- after: 0s
+  type: rebalance
+- after: 50ms
+  type: interrupted
+  noticeIn: 30s
+- after: 100ms
+  type: clear
+`), 0o600))
+		steps, err := LoadTimeline(path)
+		r.NoError(err)
+		r.Equal([]Step{
+			{Type: TypeRebalance},
+			{After: metav1.Duration{Duration: 50 * time.Millisecond}, Type: TypeInterrupted, NoticeIn: metav1.Duration{Duration: 30 * time.Second}},
+			{After: metav1.Duration{Duration: 100 * time.Millisecond}, Type: TypeClear},
+		}, steps)
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		r.NoError(srv.Play(ctx, steps))
+
+		st := srv.snapshot()
+		r.Nil(st.interruption)
+		r.Nil(st.rebalance)
+		r.Equal(3, st.incarnation)
+	})
+
+	t.Run("reject unknown step type", func(t *testing.T) {
+		r := require.New(t)
+		r.Error(New().Apply(Step{Type: "unknown"}))
+	})
+}
@@ -0,0 +1,75 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "castai_spot_handler"
+
+var registry = prometheus.NewRegistry()
+
+var (
+	operationRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "operation_retries_total",
+		Help:      "Number of retried attempts of node and mothership operations.",
+	}, []string{"operation"})
+
+	operationFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "operation_failures_total",
+		Help:      "Number of node and mothership operations which failed after all retries.",
+	}, []string{"operation"})
+
+	noticesReceived = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "notices_received_total",
+		Help:      "Number of received interruption and rebalance recommendation notices.",
+	}, []string{"type"})
+
+	dryRunActions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "dry_run_actions_total",
+		Help:      "Number of operations skipped in dry-run mode.",
+	}, []string{"operation"})
+)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		operationRetries,
+		operationFailures,
+		noticesReceived,
+		dryRunActions,
+	)
+}
+
+// Handler serves registered metrics in Prometheus format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+// OperationRetried records a failed attempt of the operation which is going to be retried.
+func OperationRetried(operation string) {
+	operationRetries.WithLabelValues(operation).Inc()
+}
+
+// OperationFailed records an operation which failed after all retries.
+func OperationFailed(operation string) {
+	operationFailures.WithLabelValues(operation).Inc()
+}
+
+// NoticeReceived records a notice of the given type.
+func NoticeReceived(noticeType string) {
+	noticesReceived.WithLabelValues(noticeType).Inc()
+}
+
+// DryRunAction records an operation which was skipped in dry-run mode.
+func DryRunAction(operation string) {
+	dryRunActions.WithLabelValues(operation).Inc()
+}
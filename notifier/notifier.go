@@ -0,0 +1,27 @@
+// Package notifier delivers interruption events to sinks other than CAST AI, e.g. incident tooling or job
+// schedulers which need to know about interruptions at the same moment as CAST AI.
+package notifier
+
+import (
+	"context"
+	"time"
+)
+
+// Event describes an interruption related event of the node.
+type Event struct {
+	// Type is the cloud event type, e.g. "interrupted" or "rebalanceRecommendation".
+	Type       string `json:"type"`
+	NodeName   string `json:"nodeName"`
+	NodeID     string `json:"nodeId,omitempty"`
+	ProviderID string `json:"providerId,omitempty"`
+	// NoticeTime is when the instance is going to be interrupted, if known.
+	NoticeTime *time.Time `json:"noticeTime,omitempty"`
+	Timestamp  time.Time  `json:"timestamp"`
+}
+
+type Notifier interface {
+	// Name identifies the notifier in logs and metrics.
+	Name() string
+	// Notify delivers the event, retrying on its own until it succeeds or ctx is done.
+	Notify(ctx context.Context, event Event) error
+}
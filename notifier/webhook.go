@@ -0,0 +1,132 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"text/template"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/go-resty/resty/v2"
+)
+
+const (
+	headerSignature = "X-Spot-Handler-Signature"
+	headerEventType = "X-Spot-Handler-Event"
+)
+
+type WebhookConfig struct {
+	URL string
+	// Template of the JSON body rendered with Event as data, the event is encoded as JSON when empty. Values
+	// should be passed through the json function to be escaped, e.g. {"text": {{ json .NodeName }}}.
+	Template string
+	// Secret is used to sign the body with HMAC-SHA256, the signature is sent in X-Spot-Handler-Signature header.
+	Secret     string
+	Timeout    time.Duration
+	MaxRetries uint64
+}
+
+// NewWebhook creates a notifier posting events to the configured HTTP endpoint.
+func NewWebhook(cfg WebhookConfig) (Notifier, error) {
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("webhook url is required")
+	}
+
+	var tmpl *template.Template
+	if cfg.Template != "" {
+		var err error
+		tmpl, err = template.New("webhook").Funcs(template.FuncMap{"json": toJSON}).Parse(cfg.Template)
+		if err != nil {
+			return nil, fmt.Errorf("parsing webhook template: %w", err)
+		}
+	}
+
+	client := resty.New()
+	if cfg.Timeout > 0 {
+		client.SetTimeout(cfg.Timeout)
+	}
+
+	return &webhook{
+		cfg:    cfg,
+		tmpl:   tmpl,
+		client: client,
+	}, nil
+}
+
+type webhook struct {
+	cfg    WebhookConfig
+	tmpl   *template.Template
+	client *resty.Client
+}
+
+func (w *webhook) Name() string {
+	return "webhook"
+}
+
+func (w *webhook) Notify(ctx context.Context, event Event) error {
+	body, err := w.render(event)
+	if err != nil {
+		return err
+	}
+
+	b := backoff.WithContext(backoff.WithMaxRetries(backoff.NewExponentialBackOff(), w.cfg.MaxRetries), ctx)
+	return backoff.Retry(func() error {
+		req := w.client.R().
+			SetContext(ctx).
+			SetHeader("Content-Type", "application/json").
+			SetHeader(headerEventType, event.Type).
+			SetBody(body)
+		if w.cfg.Secret != "" {
+			req.SetHeader(headerSignature, "sha256="+sign(w.cfg.Secret, body))
+		}
+
+		resp, err := req.Post(w.cfg.URL)
+		if err != nil {
+			return fmt.Errorf("sending webhook: %w", err)
+		}
+		if resp.IsError() {
+			err := fmt.Errorf("sending webhook: request error status_code=%d body=%s", resp.StatusCode(), resp.Body())
+			// Client errors other than rate limiting won't succeed on retry.
+			if resp.StatusCode() < http.StatusInternalServerError && resp.StatusCode() != http.StatusTooManyRequests {
+				return backoff.Permanent(err)
+			}
+			return err
+		}
+		return nil
+	}, b)
+}
+
+func (w *webhook) render(event Event) ([]byte, error) {
+	if w.tmpl == nil {
+		return json.Marshal(event)
+	}
+
+	var buf bytes.Buffer
+	if err := w.tmpl.Execute(&buf, event); err != nil {
+		return nil, fmt.Errorf("rendering webhook template: %w", err)
+	}
+	if !json.Valid(buf.Bytes()) {
+		return nil, fmt.Errorf("rendered webhook body is not valid JSON: %s", buf.String())
+	}
+	return buf.Bytes(), nil
+}
+
+func sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func toJSON(v any) (string, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
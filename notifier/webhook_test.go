@@ -0,0 +1,112 @@
+package notifier
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhook(t *testing.T) {
+	event := Event{
+		Type:      "interrupted",
+		NodeName:  "node-1",
+		NodeID:    "cast-node-id",
+		Timestamp: time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC),
+	}
+
+	t.Run("send signed event", func(t *testing.T) {
+		r := require.New(t)
+
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			body, err := io.ReadAll(req.Body)
+			r.NoError(err)
+
+			mac := hmac.New(sha256.New, []byte("secret"))
+			mac.Write(body)
+			r.Equal("sha256="+hex.EncodeToString(mac.Sum(nil)), req.Header.Get(headerSignature))
+			r.Equal("interrupted", req.Header.Get(headerEventType))
+
+			var got Event
+			r.NoError(json.Unmarshal(body, &got))
+			r.Equal(event, got)
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer s.Close()
+
+		w, err := NewWebhook(WebhookConfig{URL: s.URL, Secret: "secret"})
+		r.NoError(err)
+		r.NoError(w.Notify(context.Background(), event))
+	})
+
+	t.Run("render body template", func(t *testing.T) {
+		r := require.New(t)
+
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			body, err := io.ReadAll(req.Body)
+			r.NoError(err)
+			r.JSONEq(`{"text": "node \"node-1\" interrupted"}`, string(body))
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer s.Close()
+
+		w, err := NewWebhook(WebhookConfig{
+			URL:      s.URL,
+			Template: `{"text": {{ json (printf "node %q %s" .NodeName .Type) }}}`,
+		})
+		r.NoError(err)
+		r.NoError(w.Notify(context.Background(), event))
+	})
+
+	t.Run("reject template rendering invalid json", func(t *testing.T) {
+		r := require.New(t)
+
+		w, err := NewWebhook(WebhookConfig{URL: "http://localhost", Template: `{"text": {{ .NodeName }}}`})
+		r.NoError(err)
+		r.Error(w.Notify(context.Background(), event))
+	})
+
+	t.Run("retry server errors", func(t *testing.T) {
+		r := require.New(t)
+
+		var calls atomic.Int32
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if calls.Add(1) < 3 {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer s.Close()
+
+		w, err := NewWebhook(WebhookConfig{URL: s.URL, MaxRetries: 5})
+		r.NoError(err)
+		r.NoError(w.Notify(context.Background(), event))
+		r.Equal(int32(3), calls.Load())
+	})
+
+	t.Run("do not retry client errors", func(t *testing.T) {
+		r := require.New(t)
+
+		var calls atomic.Int32
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			calls.Add(1)
+			w.WriteHeader(http.StatusBadRequest)
+		}))
+		defer s.Close()
+
+		w, err := NewWebhook(WebhookConfig{URL: s.URL, MaxRetries: 5})
+		r.NoError(err)
+		r.Error(w.Notify(context.Background(), event))
+		r.Equal(int32(1), calls.Load())
+	})
+}
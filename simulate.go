@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/sirupsen/logrus"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/controller-runtime/pkg/manager/signals"
+
+	"github.com/castai/spot-handler/config"
+	"github.com/castai/spot-handler/handler"
+	"github.com/castai/spot-handler/version"
+)
+
+const simulatePath = "/simulate"
+
+// runSimulate handles a synthetic notice, either locally using the handler configuration from env variables or by
+// injecting it into a running handler through its simulation endpoint.
+func runSimulate(args []string) {
+	fs := flag.NewFlagSet("simulate", flag.ExitOnError)
+	noticeType := fs.String("type", handler.SimulateInterrupted, "notice type: interrupted, rebalance or maintenance; complete or clear the injected notice with --endpoint")
+	nodeName := fs.String("node", "", "node to simulate the notice on, overrides NODE_NAME")
+	dryRun := fs.Bool("dry-run", false, "only print what would happen, same as DRY_RUN")
+	endpoint := fs.String("endpoint", "", "simulation endpoint of a running handler, e.g. http://127.0.0.1:6061; SIMULATION_TOKEN is used for authentication")
+	_ = fs.Parse(args)
+
+	logger := logrus.New()
+	log := logger.WithFields(logrus.Fields{"command": "simulate", "type": *noticeType})
+	ctx := signals.SetupSignalHandler()
+
+	if *endpoint != "" {
+		if *dryRun {
+			log.Fatalf("dry-run is not supported when injecting into a running handler")
+		}
+		if err := injectNotice(ctx, *endpoint, os.Getenv("SIMULATION_TOKEN"), *noticeType); err != nil {
+			log.Fatalf("injecting notice: %v", err)
+		}
+		log.Infof("notice injected, it will be handled on the next poll")
+		return
+	}
+
+	cfg, err := config.Load(func(cfg *config.Config) {
+		if *nodeName != "" {
+			cfg.NodeName = *nodeName
+		}
+		cfg.DryRun = cfg.DryRun || *dryRun
+	})
+	if err != nil {
+		log.Fatalf("loading configuration: %v", err)
+	}
+
+	kubeconfig, err := retrieveKubeConfig(log, cfg)
+	if err != nil {
+		log.Fatalf("err retrieving kubeconfig: %v", err)
+	}
+	clientset, err := kubernetes.NewForConfig(kubeconfig)
+	if err != nil {
+		log.Fatalf("err creating clientset: %v", err)
+	}
+
+	k8sVersion, err := version.Get(log, clientset)
+	if err != nil {
+		log.Warnf("failed getting kubernetes version: %v", err)
+	}
+
+	recorder, stopEvents := handler.NewEventRecorder(clientset, k8sVersion, cfg.NodeName)
+	spotHandler, err := newSpotHandler(log.WithField("node", cfg.NodeName), logger, cfg, clientset, k8sVersion, nil, recorder)
+	if err != nil {
+		log.Fatalf("failed to create spot handler: %v", err)
+	}
+	err = spotHandler.Simulate(ctx, *noticeType)
+	// Events are sent in the background, they'd be lost on exit otherwise.
+	stopEvents()
+	if err != nil {
+		log.Fatalf("simulating notice: %v", err)
+	}
+	log.Infof("simulated notice handled")
+}
+
+func injectNotice(ctx context.Context, endpoint, token, noticeType string) error {
+	resp, err := resty.New().
+		SetTimeout(10 * time.Second).
+		R().
+		SetContext(ctx).
+		SetAuthToken(token).
+		SetBody(handler.SimulateRequest{Type: noticeType}).
+		Post(endpoint + simulatePath)
+	if err != nil {
+		return err
+	}
+	if resp.IsError() {
+		return fmt.Errorf("request error status_code=%d body=%s", resp.StatusCode(), resp.Body())
+	}
+	return nil
+}
@@ -0,0 +1,11 @@
+// Package tlsutil holds TLS helpers shared by configuration validation and the CAST AI client.
+package tlsutil
+
+import "strings"
+
+const pemPrefix = "-----BEGIN"
+
+// IsPEM reports whether the certificate is passed inline rather than as a file path.
+func IsPEM(cert string) bool {
+	return strings.HasPrefix(strings.TrimSpace(cert), pemPrefix)
+}
@@ -0,0 +1,15 @@
+package tlsutil
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsPEM(t *testing.T) {
+	r := require.New(t)
+	r.True(IsPEM("-----BEGIN CERTIFICATE-----\nMIIB\n-----END CERTIFICATE-----"))
+	r.True(IsPEM("\n  -----BEGIN CERTIFICATE-----"))
+	r.False(IsPEM("/etc/ssl/ca.pem"))
+	r.False(IsPEM(""))
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/castai/spot-handler/config"
+)
+
+// runValidateConfig checks configuration from env variables and reports all problems, e.g. for use in Helm tests.
+func runValidateConfig() {
+	_, err := config.Load()
+	if err == nil {
+		fmt.Println("configuration is valid")
+		return
+	}
+
+	var validationErr *config.ValidationError
+	if !errors.As(err, &validationErr) {
+		fmt.Fprintf(os.Stderr, "loading configuration: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Fprintln(os.Stderr, "configuration is invalid:")
+	for _, fe := range validationErr.Errors {
+		fmt.Fprintf(os.Stderr, "  %s\n", fe)
+	}
+	os.Exit(1)
+}
@@ -0,0 +1,41 @@
+package version
+
+// Minor versions of Kubernetes 1.x releases introducing features used by the handler.
+const (
+	minorEventsV1          = 19
+	minorEvictionV1        = 22
+	minorServerSideApply   = 22
+	minorOutOfServiceTaint = 26
+)
+
+// Capabilities of the cluster selecting API versions and features used by the handler.
+type Capabilities struct {
+	// EvictionV1 selects policy/v1 evictions instead of policy/v1beta1.
+	EvictionV1 bool
+	// ServerSideApply selects server-side apply instead of strategic merge patches.
+	ServerSideApply bool
+	// OutOfServiceTaint enables node.kubernetes.io/out-of-service taint.
+	OutOfServiceTaint bool
+	// EventsV1 selects events.k8s.io/v1 events instead of core/v1.
+	EventsV1 bool
+}
+
+// CapabilitiesOf returns capabilities of the cluster of the given version. Unknown version is assumed to be recent,
+// except for features which are unsafe to use on clusters not supporting them.
+func CapabilitiesOf(v Interface) Capabilities {
+	if v == nil {
+		return Capabilities{
+			EvictionV1:      true,
+			ServerSideApply: true,
+			EventsV1:        true,
+		}
+	}
+
+	minor := v.MinorInt()
+	return Capabilities{
+		EvictionV1:        minor >= minorEvictionV1,
+		ServerSideApply:   minor >= minorServerSideApply,
+		OutOfServiceTaint: minor >= minorOutOfServiceTaint,
+		EventsV1:          minor >= minorEventsV1,
+	}
+}
@@ -0,0 +1,52 @@
+package version
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/version"
+)
+
+func TestCapabilitiesOf(t *testing.T) {
+	newVersion := func(minor int) Interface {
+		return &Version{v: &version.Info{Major: "1"}, m: minor}
+	}
+
+	tests := []struct {
+		name    string
+		version Interface
+		want    Capabilities
+	}{
+		{
+			name:    "unknown version",
+			version: nil,
+			want:    Capabilities{EvictionV1: true, ServerSideApply: true, EventsV1: true},
+		},
+		{
+			name:    "1.18",
+			version: newVersion(18),
+			want:    Capabilities{},
+		},
+		{
+			name:    "1.21",
+			version: newVersion(21),
+			want:    Capabilities{EventsV1: true},
+		},
+		{
+			name:    "1.25",
+			version: newVersion(25),
+			want:    Capabilities{EvictionV1: true, ServerSideApply: true, EventsV1: true},
+		},
+		{
+			name:    "1.26",
+			version: newVersion(26),
+			want:    Capabilities{EvictionV1: true, ServerSideApply: true, OutOfServiceTaint: true, EventsV1: true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, CapabilitiesOf(tt.version))
+		})
+	}
+}